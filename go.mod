@@ -3,20 +3,31 @@ module github.com/kaweezle/krmfnbuiltin
 go 1.19
 
 require (
+	filippo.io/age v1.0.0
+	github.com/beevik/etree v1.2.0
 	github.com/go-git/go-git/v5 v5.6.1
+	github.com/hashicorp/hcl/v2 v2.17.0
 	github.com/lithammer/dedent v1.1.0
 	github.com/stretchr/testify v1.8.2
+	github.com/zclconf/go-cty v1.13.0
 	go.mozilla.org/sops/v3 v3.7.3
 	golang.org/x/tools v0.9.1
+	google.golang.org/grpc v1.45.0
 	sigs.k8s.io/kustomize/api v0.13.4
 	sigs.k8s.io/kustomize/kyaml v0.14.2
 	sigs.k8s.io/yaml v1.3.0
+)
 
+require (
+	cloud.google.com/go v0.100.2 // indirect
+	cloud.google.com/go/iam v0.3.0 // indirect
+	cloud.google.com/go/storage v1.22.0 // indirect
+	github.com/googleapis/go-type-adapters v1.0.0 // indirect
+	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
 )
 
 require (
 	cloud.google.com/go/compute v1.5.0 // indirect
-	filippo.io/age v1.0.0 // indirect
 	github.com/Azure/azure-sdk-for-go v63.3.0+incompatible // indirect
 	github.com/Azure/go-autorest v14.2.0+incompatible // indirect
 	github.com/Azure/go-autorest/autorest v0.11.26 // indirect
@@ -31,6 +42,8 @@ require (
 	github.com/Microsoft/go-winio v0.5.2 // indirect
 	github.com/ProtonMail/go-crypto v0.0.0-20230217124315-7d5c6f04bbb8 // indirect
 	github.com/acomagu/bufpipe v1.0.4 // indirect
+	github.com/agext/levenshtein v1.2.1 // indirect
+	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
 	github.com/armon/go-metrics v0.3.10 // indirect
 	github.com/armon/go-radix v1.0.0 // indirect
 	github.com/asaskevich/govalidator v0.0.0-20190424111038-f61b66f89f4a // indirect
@@ -126,7 +139,6 @@ require (
 	google.golang.org/api v0.74.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20220405205423-9d709892a2bf // indirect
-	google.golang.org/grpc v1.45.0 // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
 	gopkg.in/ini.v1 v1.66.4 // indirect
 	gopkg.in/square/go-jose.v2 v2.6.0 // indirect
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/kaweezle/krmfnbuiltin/pkg/extras"
 	"github.com/kaweezle/krmfnbuiltin/pkg/plugins"
 	"github.com/kaweezle/krmfnbuiltin/pkg/utils"
 
@@ -62,6 +63,10 @@ func main() {
 				return errors.WrapPrefixf(err, "Transforming resources")
 			}
 
+			if reporter, ok := transformer.(extras.ResultsReporter); ok {
+				rl.Results = append(rl.Results, reporter.Results()...)
+			}
+
 			configAnnotations := config.GetAnnotations()
 
 			if _, ok := configAnnotations[utils.FunctionAnnotationCleanup]; ok {
@@ -0,0 +1,279 @@
+package extras
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	kyaml_utils "sigs.k8s.io/kustomize/kyaml/utils"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultChecksumAnnotation is the annotation receiving the checksum when
+// none is specified.
+const defaultChecksumAnnotation = "checksum/config"
+
+// ChecksumSource selects the resources whose content is included in the
+// checksum.
+type ChecksumSource struct {
+	types.Selector `json:",inline" yaml:",inline"`
+
+	// Fields of the resources included in the checksum. Extended paths are
+	// allowed. If empty, the whole resource except its metadata and status is
+	// included.
+	FieldPaths []string `json:"fieldPaths,omitempty" yaml:"fieldPaths,omitempty"`
+}
+
+// ChecksumTransformerPlugin writes in the pod template of the targets an
+// annotation containing the checksum of the resources they depend on. This
+// allows rolling the workloads when their configuration changes.
+//
+// If Sources is empty, the ConfigMaps and Secrets referenced by the volumes,
+// envFrom and env of the pod template are used.
+type ChecksumTransformerPlugin struct {
+	Annotation string            `json:"annotation,omitempty" yaml:"annotation,omitempty"`
+	Sources    []*ChecksumSource `json:"sources,omitempty" yaml:"sources,omitempty"`
+	Targets    []*types.Selector `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+// Config reads the function configuration.
+func (p *ChecksumTransformerPlugin) Config(
+	h *resmap.PluginHelpers, c []byte) (err error) {
+	err = yaml.Unmarshal(c, p)
+	if err != nil {
+		return err
+	}
+	if p.Annotation == "" {
+		p.Annotation = defaultChecksumAnnotation
+	}
+	return err
+}
+
+// podTemplatePaths contains the paths of pod templates in workloads, by order
+// of precedence.
+var podTemplatePaths = [][]string{
+	{"spec", "jobTemplate", "spec", "template"},
+	{"spec", "template"},
+}
+
+// podTemplate returns the pod template of the workload r. For pods, the pod
+// itself is returned. It returns nil if r has no pod template.
+func podTemplate(r *resource.Resource) (*kyaml.RNode, error) {
+	for _, path := range podTemplatePaths {
+		template, err := r.Pipe(kyaml.Lookup(path...))
+		if err != nil {
+			return nil, err
+		}
+		if template != nil {
+			return template, nil
+		}
+	}
+	if r.GetKind() == "Pod" {
+		return &r.RNode, nil
+	}
+	return nil, nil
+}
+
+// podReferencePaths contains the paths of the ConfigMaps and Secrets names
+// referenced in pod specs, relative to the volumes and containers.
+var podReferencePaths = map[string][][]string{
+	"ConfigMap": {
+		{"volumes", "*", "configMap", "name"},
+		{"volumes", "*", "projected", "sources", "*", "configMap", "name"},
+		{"containers", "*", "envFrom", "*", "configMapRef", "name"},
+		{"containers", "*", "env", "*", "valueFrom", "configMapKeyRef", "name"},
+		{"initContainers", "*", "envFrom", "*", "configMapRef", "name"},
+		{"initContainers", "*", "env", "*", "valueFrom", "configMapKeyRef", "name"},
+	},
+	"Secret": {
+		{"volumes", "*", "secret", "secretName"},
+		{"volumes", "*", "projected", "sources", "*", "secret", "name"},
+		{"containers", "*", "envFrom", "*", "secretRef", "name"},
+		{"containers", "*", "env", "*", "valueFrom", "secretKeyRef", "name"},
+		{"initContainers", "*", "envFrom", "*", "secretRef", "name"},
+		{"initContainers", "*", "env", "*", "valueFrom", "secretKeyRef", "name"},
+	},
+}
+
+// referencedSources returns the ConfigMaps and Secrets of m referenced by
+// template, the pod template of target. References to resources not in m are
+// ignored.
+func referencedSources(m resmap.ResMap, target *resource.Resource, template *kyaml.RNode) ([]*resource.Resource, error) {
+	spec := template.Field("spec")
+	if spec == nil {
+		return nil, nil
+	}
+
+	targetId := target.CurId()
+	result := []*resource.Resource{}
+	for kind, paths := range podReferencePaths {
+		names := map[string]bool{}
+		for _, path := range paths {
+			matches, err := spec.Value.Pipe(&kyaml.PathMatcher{Path: path})
+			if err != nil {
+				return nil, errors.WrapPrefixf(err, "while looking for %s references in %s", kind, targetId)
+			}
+			if matches == nil {
+				continue
+			}
+			elements, err := matches.Elements()
+			if err != nil {
+				return nil, err
+			}
+			for _, element := range elements {
+				names[kyaml.GetValue(element)] = true
+			}
+		}
+		for _, r := range m.Resources() {
+			id := r.CurId()
+			if id.Kind == kind && names[id.Name] && id.IsNsEquals(targetId) {
+				result = append(result, r)
+			}
+		}
+	}
+	return result, nil
+}
+
+// checksumContent returns the content of r included in the checksum. It is
+// serialized in JSON so that the order of mapping keys doesn't matter.
+func checksumContent(r *resource.Resource, fieldPaths []string) ([]byte, error) {
+	values := []interface{}{}
+	if len(fieldPaths) == 0 {
+		content := r.RNode.Copy()
+		if _, err := content.Pipe(kyaml.Clear("metadata"), kyaml.Clear("status")); err != nil {
+			return nil, err
+		}
+		value, err := templateValue(content)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	for _, fp := range fieldPaths {
+		extendedPath, err := NewExtendedPath(kyaml_utils.SmarterPathSplitter(fp, "."))
+		if err != nil {
+			return nil, err
+		}
+		node, err := extendedPath.Get(&r.RNode)
+		if err != nil {
+			return nil, errors.WrapPrefixf(err, "while getting %s in %s", fp, r.CurId())
+		}
+		if node == nil {
+			return nil, fmt.Errorf("field %s not found in %s", fp, r.CurId())
+		}
+		value, err := templateValue(node)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return json.Marshal(values)
+}
+
+// checksumEntry is the content of a resource included in a checksum.
+type checksumEntry struct {
+	id      resid.ResId
+	content []byte
+}
+
+// checksum returns the hex encoded SHA-256 sum of the entries. The entries
+// are sorted by resource id so that the checksum is stable.
+func checksum(entries []checksumEntry) string {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id.String() < entries[j].id.String()
+	})
+	h := sha256.New()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s\n%s\n", entry.id, entry.content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// explicitEntries returns the checksum entries of the configured sources.
+func (p *ChecksumTransformerPlugin) explicitEntries(m resmap.ResMap) ([]checksumEntry, error) {
+	entries := []checksumEntry{}
+	for _, source := range p.Sources {
+		resources, err := m.Select(source.Selector)
+		if err != nil {
+			return nil, errors.WrapPrefixf(err, "while selecting source %s", source.Selector.String())
+		}
+		if len(resources) == 0 {
+			return nil, fmt.Errorf("nothing selected by source %s", source.Selector.String())
+		}
+		for _, r := range resources {
+			content, err := checksumContent(r, source.FieldPaths)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, checksumEntry{id: r.CurId(), content: content})
+		}
+	}
+	return entries, nil
+}
+
+// Transform adds the checksum annotation to the pod templates of the targets.
+// Targets without pod template are skipped.
+func (p *ChecksumTransformerPlugin) Transform(m resmap.ResMap) error {
+	if p.Targets == nil {
+		return fmt.Errorf("must specify at least one target")
+	}
+
+	var explicit []checksumEntry
+	if len(p.Sources) > 0 {
+		var err error
+		if explicit, err = p.explicitEntries(m); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range p.Targets {
+		targets, err := m.Select(*t)
+		if err != nil {
+			return errors.WrapPrefixf(err, "while selecting target %s", t.String())
+		}
+		for _, target := range targets {
+			template, err := podTemplate(target)
+			if err != nil {
+				return err
+			}
+			if template == nil {
+				// Selectors like labels may match resources that aren't workloads.
+				continue
+			}
+
+			entries := explicit
+			if entries == nil {
+				sources, err := referencedSources(m, target, template)
+				if err != nil {
+					return err
+				}
+				entries = []checksumEntry{}
+				for _, source := range sources {
+					content, err := checksumContent(source, nil)
+					if err != nil {
+						return err
+					}
+					entries = append(entries, checksumEntry{id: source.CurId(), content: content})
+				}
+			}
+
+			if _, err := template.Pipe(kyaml.SetAnnotation(p.Annotation, checksum(entries))); err != nil {
+				return errors.WrapPrefixf(err, "while setting checksum on %s", target.CurId())
+			}
+		}
+	}
+	return nil
+}
+
+// NewChecksumTransformerPlugin returns a newly created [ChecksumTransformerPlugin].
+func NewChecksumTransformerPlugin() resmap.TransformerPlugin {
+	return &ChecksumTransformerPlugin{}
+}
@@ -0,0 +1,170 @@
+package extras
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/stretchr/testify/suite"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+type ChecksumTransformerTestSuite struct {
+	suite.Suite
+}
+
+// checksumWorkloads contains the workloads used to test the checksums.
+const checksumWorkloads = `
+	apiVersion: apps/v1
+	kind: Deployment
+	metadata:
+	  name: app
+	spec:
+	  template:
+	    spec:
+	      volumes:
+	        - name: config
+	          configMap:
+	            name: app-config
+	      containers:
+	        - name: app
+	          envFrom:
+	            - secretRef:
+	                name: app-secret
+	            - configMapRef:
+	                name: external
+	---
+	apiVersion: batch/v1
+	kind: CronJob
+	metadata:
+	  name: job
+	spec:
+	  jobTemplate:
+	    spec:
+	      template:
+	        spec:
+	          containers:
+	            - name: job
+	---
+	apiVersion: v1
+	kind: Secret
+	metadata:
+	  name: app-secret
+	data:
+	  password: c2VjcmV0
+	`
+
+func (s *ChecksumTransformerTestSuite) TestChecksumTransformer() {
+	require := s.Require()
+	config := dedent.Dedent(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: app-config
+		data:
+		  config.yaml: |
+		    server:
+		      port: 8080
+		    logLevel: info
+		`)
+	checksums := func(config string, plugin string) (string, string) {
+		m := newResMap(require, checksumWorkloads, config)
+		transformer := NewChecksumTransformerPlugin()
+		require.NoError(transformer.Config(nil, []byte(plugin)))
+		require.NoError(transformer.Transform(m))
+		deployment, err := m.GetById(resid.NewResId(resid.NewGvk("apps", "v1", "Deployment"), "app"))
+		require.NoError(err)
+		cronJob, err := m.GetById(resid.NewResId(resid.NewGvk("batch", "v1", "CronJob"), "job"))
+		require.NoError(err)
+		deploymentChecksum, err := deployment.Pipe(yaml.Lookup("spec", "template", "metadata", "annotations", "checksum/config"))
+		require.NoError(err)
+		cronJobChecksum, err := cronJob.Pipe(yaml.Lookup("spec", "jobTemplate", "spec", "template", "metadata", "annotations", "checksum/config"))
+		require.NoError(err)
+		require.NotNil(deploymentChecksum)
+		require.NotNil(cronJobChecksum)
+		return yaml.GetValue(deploymentChecksum), yaml.GetValue(cronJobChecksum)
+	}
+
+	discovery := dedent.Dedent(`
+		targets:
+		  - kind: Deployment
+		  - kind: CronJob
+		`)
+	deploymentChecksum, cronJobChecksum := checksums(config, discovery)
+	require.Len(deploymentChecksum, 64)
+	require.NotEqual(deploymentChecksum, cronJobChecksum, "the cron job doesn't reference any source")
+
+	relabeled := strings.Replace(config, "  name: app-config\n", "  name: app-config\n  labels:\n    app: demo\n", 1)
+	checksum, _ := checksums(relabeled, discovery)
+	require.Equal(deploymentChecksum, checksum, "metadata should not change the checksum")
+
+	changed := strings.Replace(config, "logLevel: info", "logLevel: debug", 1)
+	checksum, _ = checksums(changed, discovery)
+	require.NotEqual(deploymentChecksum, checksum, "data changes should change the checksum")
+
+	explicit := dedent.Dedent(`
+		sources:
+		  - kind: ConfigMap
+		    name: app-config
+		    fieldPaths:
+		      - data.config\.yaml.!!yaml.server
+		targets:
+		  - kind: Deployment
+		  - kind: CronJob
+		`)
+	deploymentChecksum, cronJobChecksum = checksums(config, explicit)
+	require.Equal(deploymentChecksum, cronJobChecksum, "explicit sources apply to all targets")
+	checksum, _ = checksums(changed, explicit)
+	require.Equal(deploymentChecksum, checksum, "changes outside of the field paths should not change the checksum")
+	changed = strings.Replace(config, "port: 8080", "port: 9090", 1)
+	checksum, _ = checksums(changed, explicit)
+	require.NotEqual(deploymentChecksum, checksum, "changes in the field paths should change the checksum")
+}
+
+func (s *ChecksumTransformerTestSuite) TestChecksumTransformerMixedTargets() {
+	require := s.Require()
+	m := newResMap(require, checksumWorkloads, `
+		apiVersion: v1
+		kind: Service
+		metadata:
+		  name: app
+		  labels:
+		    app: demo
+		spec:
+		  ports:
+		    - port: 80
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: app-config
+		  labels:
+		    app: demo
+		data:
+		  logLevel: info
+		`)
+	deployment, err := m.GetById(resid.NewResId(resid.NewGvk("apps", "v1", "Deployment"), "app"))
+	require.NoError(err)
+	require.NoError(deployment.SetLabels(map[string]string{"app": "demo"}))
+
+	transformer := NewChecksumTransformerPlugin()
+	require.NoError(transformer.Config(nil, []byte(dedent.Dedent(`
+		targets:
+		  - labelSelector: app=demo
+		`))))
+	require.NoError(transformer.Transform(m), "resources without pod template should be skipped")
+
+	checksum, err := deployment.Pipe(yaml.Lookup("spec", "template", "metadata", "annotations", "checksum/config"))
+	require.NoError(err)
+	require.NotNil(checksum)
+	for _, r := range m.Resources() {
+		if r.GetKind() != "Deployment" {
+			require.Empty(r.GetAnnotations(), "%s should be untouched", r.CurId())
+		}
+	}
+}
+
+func TestChecksumTransformer(t *testing.T) {
+	suite.Run(t, new(ChecksumTransformerTestSuite))
+}
@@ -3,20 +3,42 @@ package extras
 import (
 	"fmt"
 
-	git "github.com/go-git/go-git/v5"
+	"github.com/kaweezle/krmfnbuiltin/pkg/utils"
 	"sigs.k8s.io/kustomize/api/kv"
 	"sigs.k8s.io/kustomize/api/resmap"
 	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/errors"
-	"sigs.k8s.io/yaml"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+	oyaml "sigs.k8s.io/yaml"
 )
 
+// Outputs of the GitConfigMapGenerator.
+const (
+	// ConfigMapGitOutput generates a flat ConfigMap.
+	ConfigMapGitOutput = "configMap"
+	// StructuredGitOutput generates a local configuration resource with the
+	// git facts nested in data.git.
+	StructuredGitOutput = "structured"
+)
+
+// defaultGitKind is the kind of the structured resource.
+const defaultGitKind = "GitConfiguration"
+
 // GitConfigMapGeneratorPlugin generates a config map that includes two
 // properties of the current git repository:
 //
 //   - repoURL contains the URL or the remote specified by remoteName. by
-//     default, it takes the URL of the remote named "origin".
-//   - targetRevision contains the name of the current branch.
+//     default, it takes the URL of the remote named "origin". It can be
+//     normalized with URL (see [GitURLOptions]).
+//   - targetRevision contains the name of the current branch. When HEAD is
+//     detached, DetachedHead gives the fallbacks to use.
+//
+// Additional properties of the current commit can be added with Properties
+// (see [GitProperty]).
+//
+// With the structured Output, the generator produces instead a local
+// configuration resource, like the heredoc generator, with the properties in
+// data.git. It allows capturing several remotes with Remotes.
 //
 // This generator is useful in transformations that use those values, like for
 // instance Argo CD application customization.
@@ -30,12 +52,24 @@ type GitConfigMapGeneratorPlugin struct {
 	types.ConfigMapArgs
 	// The name of the remote which URL to include. defaults to "origin".
 	RemoteName string `json:"remoteName,omitempty" yaml:"remoteName,omitempty"`
+	// Normalization of the remote URL.
+	URL *GitURLOptions `json:"url,omitempty" yaml:"url,omitempty"`
+	// Additional properties to include.
+	Properties []GitProperty `json:"properties,omitempty" yaml:"properties,omitempty"`
+	// Revisions tried in order for targetRevision when HEAD is detached: tag,
+	// sha, shortSha or env:NAME for an environment variable. If none gives a
+	// value, HEAD is used.
+	DetachedHead []string `json:"detachedHead,omitempty" yaml:"detachedHead,omitempty"`
+	// The output of the generator: configMap (default) or structured.
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+	// The remotes included in the structured output. Defaults to remoteName.
+	Remotes []string `json:"remotes,omitempty" yaml:"remotes,omitempty"`
 }
 
 // Config configures the generator with the functionConfig passed in config.
 func (p *GitConfigMapGeneratorPlugin) Config(h *resmap.PluginHelpers, config []byte) (err error) {
 	p.ConfigMapArgs = types.ConfigMapArgs{}
-	err = yaml.Unmarshal(config, p)
+	err = oyaml.Unmarshal(config, p)
 	if p.ConfigMapArgs.Name == "" {
 		p.ConfigMapArgs.Name = p.Name
 	}
@@ -46,34 +80,167 @@ func (p *GitConfigMapGeneratorPlugin) Config(h *resmap.PluginHelpers, config []b
 	return
 }
 
-// Generate generates the config map
+// remoteURL returns the normalized URL of the remote name.
+func (p *GitConfigMapGeneratorPlugin) remoteURL(repo *gitRepository, name string) (string, error) {
+	remote, err := repo.repo.Remote(name)
+	if err != nil {
+		return "", errors.WrapPrefixf(err, "getting remote %s", name)
+	}
+	return p.URL.Normalize(remote.Config().URLs[0])
+}
+
+// checkStructuredArgs returns an error if config map arguments that don't
+// apply to the structured output are specified.
+func (p *GitConfigMapGeneratorPlugin) checkStructuredArgs() error {
+	sources := p.ConfigMapArgs.KvPairSources
+	switch {
+	case len(sources.LiteralSources) > 0, len(sources.FileSources) > 0,
+		len(sources.EnvSources) > 0, sources.EnvSource != "":
+		return fmt.Errorf("literals, files and envs cannot be used with the structured output")
+	case p.ConfigMapArgs.Options != nil:
+		return fmt.Errorf("options cannot be used with the structured output, use metadata labels and annotations instead")
+	case p.ConfigMapArgs.Behavior != "":
+		return fmt.Errorf("behavior cannot be used with the structured output")
+	}
+	return nil
+}
+
+// structuredResource returns the git facts as a nested local configuration
+// resource. The facts are in data.git.
+func (p *GitConfigMapGeneratorPlugin) structuredResource(repo *gitRepository, remoteName string, repoURL string, revision string, properties *yaml.RNode) (*yaml.RNode, error) {
+	git := yaml.NewMapRNode(nil)
+	fields := []*yaml.MapNode{
+		{Key: yaml.NewScalarRNode("repoURL"), Value: yaml.NewStringRNode(repoURL)},
+		{Key: yaml.NewScalarRNode("targetRevision"), Value: yaml.NewStringRNode(revision)},
+		{Key: yaml.NewScalarRNode("remote"), Value: yaml.NewMapRNode(&map[string]string{"name": remoteName, "url": repoURL})},
+	}
+
+	remoteNames := p.Remotes
+	if len(remoteNames) == 0 {
+		remoteNames = []string{remoteName}
+	}
+	remotes := yaml.NewMapRNode(nil)
+	for _, name := range remoteNames {
+		url, err := p.remoteURL(repo, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := remotes.PipeE(yaml.SetField(name, yaml.NewMapRNode(&map[string]string{"url": url}))); err != nil {
+			return nil, err
+		}
+	}
+	fields = append(fields, &yaml.MapNode{Key: yaml.NewScalarRNode("remotes"), Value: remotes})
+
+	for _, field := range fields {
+		if err := git.PipeE(yaml.SetField(field.Key.YNode().Value, field.Value)); err != nil {
+			return nil, err
+		}
+	}
+	if err := properties.VisitFields(func(field *yaml.MapNode) error {
+		return git.PipeE(yaml.SetField(field.Key.YNode().Value, field.Value))
+	}); err != nil {
+		return nil, err
+	}
+
+	r := yaml.NewMapRNode(nil)
+	r.SetApiVersion(defaultApiVersion)
+	r.SetKind(defaultGitKind)
+	if err := r.SetName(p.ObjectMeta.Name); err != nil {
+		return nil, err
+	}
+	if p.ObjectMeta.Namespace != "" {
+		if err := r.SetNamespace(p.ObjectMeta.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	// Like heredoc documents, the resource keeps the labels and annotations
+	// of the configuration.
+	if len(p.ObjectMeta.Labels) > 0 {
+		if err := r.SetLabels(p.ObjectMeta.Labels); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.ObjectMeta.Annotations) > 0 {
+		if err := r.SetAnnotations(p.ObjectMeta.Annotations); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.PipeE(yaml.SetAnnotation(utils.FunctionAnnotationInjectLocal, "true")); err != nil {
+		return nil, err
+	}
+	if err := r.SetMapField(git, "data", "git"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Generate generates the config map or the structured resource.
 func (p *GitConfigMapGeneratorPlugin) Generate() (resmap.ResMap, error) {
 	// Add git repository properties
 
-	repo, err := git.PlainOpenWithOptions(p.h.Loader().Root(), &git.PlainOpenOptions{DetectDotGit: true})
+	repo, err := openGitRepository(p.h.Loader().Root())
 	if err != nil {
-		return resmap.New(), errors.WrapPrefixf(err, "opening git repo")
+		return resmap.New(), err
 	}
-	// TODO: Should come from config
 	remoteName := p.RemoteName
 	if remoteName == "" {
 		remoteName = "origin"
 	}
-	origin, err := repo.Remote(remoteName)
+	repoURL, err := p.remoteURL(repo, remoteName)
 	if err != nil {
-		return resmap.New(), errors.WrapPrefixf(err, "getting remote %s", remoteName)
+		return resmap.New(), err
 	}
 
-	p.ConfigMapArgs.KvPairSources.LiteralSources = append(p.ConfigMapArgs.KvPairSources.LiteralSources,
-		fmt.Sprintf("repoURL=%s", origin.Config().URLs[0]))
-
-	head, err := repo.Head()
+	revision, err := repo.revision(p.DetachedHead)
 	if err != nil {
-		return resmap.New(), errors.WrapPrefixf(err, "getting current branch")
+		return resmap.New(), err
+	}
+
+	properties := yaml.NewMapRNode(nil)
+	for _, property := range p.Properties {
+		value, err := repo.property(property, p.h.Loader().Root())
+		if err != nil {
+			return resmap.New(), errors.WrapPrefixf(err, "getting git property %s", property)
+		}
+		node := yaml.NewStringRNode(value)
+		if property == DirtyProperty {
+			node = yaml.NewScalarRNode(value)
+			node.YNode().Tag = yaml.NodeTagBool
+		}
+		if err := properties.PipeE(yaml.SetField(string(property), node)); err != nil {
+			return resmap.New(), err
+		}
+	}
+
+	switch p.Output {
+	case "", ConfigMapGitOutput:
+	case StructuredGitOutput:
+		if err := p.checkStructuredArgs(); err != nil {
+			return resmap.New(), err
+		}
+		r, err := p.structuredResource(repo, remoteName, repoURL, revision, properties)
+		if err != nil {
+			return resmap.New(), err
+		}
+		return utils.ResourceMapFromNodes([]*yaml.RNode{r}), nil
+	default:
+		return resmap.New(), fmt.Errorf("unknown output %s", p.Output)
+	}
+
+	if len(p.Remotes) > 0 {
+		return resmap.New(), fmt.Errorf("remotes can only be used with the structured output")
 	}
 
 	p.ConfigMapArgs.KvPairSources.LiteralSources = append(p.ConfigMapArgs.KvPairSources.LiteralSources,
-		fmt.Sprintf("targetRevision=%s", head.Name().Short()))
+		fmt.Sprintf("repoURL=%s", repoURL),
+		fmt.Sprintf("targetRevision=%s", revision))
+	if err := properties.VisitFields(func(field *yaml.MapNode) error {
+		p.ConfigMapArgs.KvPairSources.LiteralSources = append(p.ConfigMapArgs.KvPairSources.LiteralSources,
+			fmt.Sprintf("%s=%s", field.Key.YNode().Value, field.Value.YNode().Value))
+		return nil
+	}); err != nil {
+		return resmap.New(), err
+	}
 
 	return p.h.ResmapFactory().FromConfigMapArgs(
 		kv.NewLoader(p.h.Loader(), p.h.Validator()), p.ConfigMapArgs)
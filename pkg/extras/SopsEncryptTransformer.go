@@ -0,0 +1,299 @@
+package extras
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"go.mozilla.org/sops/v3/config"
+	"go.mozilla.org/sops/v3/pgp"
+	"go.mozilla.org/sops/v3/version"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultSopsUnencryptedRegex keeps the fields identifying the resources
+// unencrypted when no encryption policy is specified.
+const defaultSopsUnencryptedRegex = "^(apiVersion|kind|metadata)$"
+
+// SopsEncryptTransformerPlugin encrypts the target resources with sops.
+//
+// The recipients are either given inline or taken from the creation rule of
+// the sops configuration file matching the path of the resource. Values that
+// didn't change since the previous encryption, found in Previous, keep their
+// ciphertext. As sops encryption is not deterministic, Previous is required
+// to get stable ciphertexts: without it, each run changes all the values.
+type SopsEncryptTransformerPlugin struct {
+	Targets []*types.Selector `json:"targets,omitempty" yaml:"targets,omitempty"`
+
+	// Age recipients.
+	Age []string `json:"age,omitempty" yaml:"age,omitempty"`
+	// PGP fingerprints.
+	PGP []string `json:"pgp,omitempty" yaml:"pgp,omitempty"`
+	// Path of the sops configuration file used when no recipient is given,
+	// relative to the kustomization root. Defaults to the first .sops.yaml
+	// file found from the kustomization root and its parents.
+	ConfigFile string `json:"configFile,omitempty" yaml:"configFile,omitempty"`
+
+	// Encryption policy. Only one can be specified. If none is, the policy of
+	// the creation rule is used, and then defaultSopsUnencryptedRegex.
+	UnencryptedSuffix string `json:"unencryptedSuffix,omitempty" yaml:"unencryptedSuffix,omitempty"`
+	EncryptedSuffix   string `json:"encryptedSuffix,omitempty" yaml:"encryptedSuffix,omitempty"`
+	UnencryptedRegex  string `json:"unencryptedRegex,omitempty" yaml:"unencryptedRegex,omitempty"`
+	EncryptedRegex    string `json:"encryptedRegex,omitempty" yaml:"encryptedRegex,omitempty"`
+
+	// Files containing the previously encrypted version of the resources.
+	Previous []string `json:"previous,omitempty" yaml:"previous,omitempty"`
+
+	h *resmap.PluginHelpers
+}
+
+// policyCount returns the number of encryption policies specified.
+func (p *SopsEncryptTransformerPlugin) policyCount() int {
+	count := 0
+	for _, policy := range []string{p.UnencryptedSuffix, p.EncryptedSuffix, p.UnencryptedRegex, p.EncryptedRegex} {
+		if policy != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// Config reads the function configuration.
+func (p *SopsEncryptTransformerPlugin) Config(
+	h *resmap.PluginHelpers, c []byte) (err error) {
+	err = yaml.Unmarshal(c, p)
+	if err != nil {
+		return err
+	}
+	if p.policyCount() > 1 {
+		return fmt.Errorf("only one of unencryptedSuffix, encryptedSuffix, unencryptedRegex and encryptedRegex can be specified")
+	}
+	p.h = h
+	return nil
+}
+
+// creationRule returns the sops configuration of the creation rule matching
+// path.
+func (p *SopsEncryptTransformerPlugin) creationRule(path string) (*config.Config, error) {
+	root := "."
+	if p.h != nil {
+		root = p.h.Loader().Root()
+	}
+	confPath := p.ConfigFile
+	if confPath == "" {
+		var err error
+		// The search starts from the directory of the path given.
+		if confPath, err = config.FindConfigFile(filepath.Join(root, ".sops.yaml")); err != nil {
+			return nil, fmt.Errorf("no recipient specified and no .sops.yaml configuration file found")
+		}
+	} else if !filepath.IsAbs(confPath) {
+		confPath = filepath.Join(root, confPath)
+	}
+	conf, err := config.LoadCreationRuleForFile(confPath, path, nil)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while loading creation rule of %q from %s", path, confPath)
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("no creation rule in %s", confPath)
+	}
+	return conf, nil
+}
+
+// metadata returns the sops metadata of the resource saved in path.
+func (p *SopsEncryptTransformerPlugin) metadata(path string) (*sops.Metadata, error) {
+	metadata := &sops.Metadata{
+		UnencryptedSuffix: p.UnencryptedSuffix,
+		EncryptedSuffix:   p.EncryptedSuffix,
+		UnencryptedRegex:  p.UnencryptedRegex,
+		EncryptedRegex:    p.EncryptedRegex,
+		Version:           version.Version,
+	}
+	if len(p.Age) > 0 || len(p.PGP) > 0 {
+		group := sops.KeyGroup{}
+		ageKeys, err := age.MasterKeysFromRecipients(strings.Join(p.Age, ","))
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range ageKeys {
+			group = append(group, key)
+		}
+		for _, key := range pgp.MasterKeysFromFingerprintString(strings.Join(p.PGP, ",")) {
+			group = append(group, key)
+		}
+		metadata.KeyGroups = []sops.KeyGroup{group}
+	} else {
+		conf, err := p.creationRule(path)
+		if err != nil {
+			return nil, err
+		}
+		metadata.KeyGroups = conf.KeyGroups
+		metadata.ShamirThreshold = conf.ShamirThreshold
+		if p.policyCount() == 0 {
+			metadata.UnencryptedSuffix = conf.UnencryptedSuffix
+			metadata.EncryptedSuffix = conf.EncryptedSuffix
+			metadata.UnencryptedRegex = conf.UnencryptedRegex
+			metadata.EncryptedRegex = conf.EncryptedRegex
+		}
+	}
+	if metadata.UnencryptedSuffix == "" && metadata.EncryptedSuffix == "" &&
+		metadata.UnencryptedRegex == "" && metadata.EncryptedRegex == "" {
+		metadata.UnencryptedRegex = defaultSopsUnencryptedRegex
+	}
+	return metadata, nil
+}
+
+// previousTree is the previously encrypted version of a resource.
+type previousTree struct {
+	id   resid.ResId
+	tree *sops.Tree
+}
+
+// loadPrevious loads the encrypted resources of the Previous files.
+func (p *SopsEncryptTransformerPlugin) loadPrevious() ([]previousTree, error) {
+	result := []previousTree{}
+	store := common.StoreForFormat(formats.Yaml)
+	for _, file := range p.Previous {
+		b, err := p.h.Loader().Load(file)
+		if err != nil {
+			return nil, errors.WrapPrefixf(err, "error reading previous file %q", file)
+		}
+		nodes, err := kio.FromBytes(b)
+		if err != nil {
+			return nil, errors.WrapPrefixf(err, "error parsing previous file %q", file)
+		}
+		for _, node := range nodes {
+			if !isSopsEncrypted(node) {
+				continue
+			}
+			content, err := node.String()
+			if err != nil {
+				return nil, err
+			}
+			tree, err := store.LoadEncryptedFile([]byte(content))
+			if err != nil {
+				return nil, errors.WrapPrefixf(err, "error loading encrypted resource %s of %q", resid.FromRNode(node), file)
+			}
+			result = append(result, previousTree{id: resid.FromRNode(node), tree: &tree})
+		}
+	}
+	return result, nil
+}
+
+// encrypt encrypts r in place. If previous is not nil and encrypted with the
+// same recipients and policy, its data key is reused as well as the
+// ciphertext of the unchanged values.
+func (p *SopsEncryptTransformerPlugin) encrypt(r *resource.Resource, previous *sops.Tree) error {
+	node := r.RNode.Copy()
+	internal, err := removeInternalAnnotations(node)
+	if err != nil {
+		return err
+	}
+	path, found := internal[kioutil.PathAnnotation]
+	if !found {
+		path = internal[kioutil.LegacyPathAnnotation]
+	}
+	metadata, err := p.metadata(path)
+	if err != nil {
+		return err
+	}
+
+	content, err := node.String()
+	if err != nil {
+		return err
+	}
+	store := common.StoreForFormat(formats.Yaml)
+	branches, err := store.LoadPlainFile([]byte(content))
+	if err != nil {
+		return err
+	}
+	tree := sops.Tree{Branches: branches, Metadata: *metadata}
+
+	cipher := newStableCipher(aes.NewCipher())
+	var dataKey []byte
+	previousMac := ""
+	if previous != nil && sameSopsPolicy(&previous.Metadata, metadata) {
+		if dataKey, err = previous.Metadata.GetDataKeyWithKeyServices(sopsKeyServices()); err != nil {
+			return errors.WrapPrefixf(err, "while getting the data key of the previous version of %s", r.CurId())
+		}
+		if previousMac, err = previous.Decrypt(dataKey, cipher); err != nil {
+			return errors.WrapPrefixf(err, "while decrypting the previous version of %s", r.CurId())
+		}
+		tree.Metadata = previous.Metadata
+	} else {
+		var errs []error
+		if dataKey, errs = tree.GenerateDataKeyWithKeyServices(sopsKeyServices()); len(errs) > 0 {
+			return fmt.Errorf("could not generate data key for %s: %s", r.CurId(), errs)
+		}
+	}
+
+	if err := encryptSopsTree(&tree, dataKey, cipher, previousMac); err != nil {
+		return errors.WrapPrefixf(err, "while encrypting %s", r.CurId())
+	}
+	encrypted, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		return err
+	}
+	encryptedNode, err := kyaml.Parse(string(encrypted))
+	if err != nil {
+		return err
+	}
+	if err := restoreAnnotations(encryptedNode, internal); err != nil {
+		return err
+	}
+	r.SetYNode(encryptedNode.YNode())
+	return nil
+}
+
+// Transform encrypts the targets. Targets already encrypted are left
+// untouched.
+func (p *SopsEncryptTransformerPlugin) Transform(m resmap.ResMap) error {
+	if p.Targets == nil {
+		return fmt.Errorf("must specify at least one target")
+	}
+
+	previous, err := p.loadPrevious()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range p.Targets {
+		targets, err := m.Select(*t)
+		if err != nil {
+			return errors.WrapPrefixf(err, "while selecting target %s", t.String())
+		}
+		for _, target := range targets {
+			if isSopsEncrypted(&target.RNode) {
+				continue
+			}
+			var previousVersion *sops.Tree
+			for _, pt := range previous {
+				if pt.id.Equals(target.CurId()) {
+					previousVersion = pt.tree
+					break
+				}
+			}
+			if err := p.encrypt(target, previousVersion); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NewSopsEncryptTransformerPlugin returns a newly created [SopsEncryptTransformerPlugin].
+func NewSopsEncryptTransformerPlugin() resmap.TransformerPlugin {
+	return &SopsEncryptTransformerPlugin{}
+}
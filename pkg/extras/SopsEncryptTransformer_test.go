@@ -0,0 +1,121 @@
+package extras
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/stretchr/testify/suite"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+type SopsEncryptTransformerTestSuite struct {
+	suite.Suite
+}
+
+func (s *SopsEncryptTransformerTestSuite) TestSopsEncryptTransformer() {
+	require := s.Require()
+	s.T().Setenv("SOPS_AGE_KEY", testAgeIdentity)
+	dir := s.T().TempDir()
+	h := pluginHelpers(require, dir)
+	config := dedent.Dedent(`
+		targets:
+		  - kind: Secret
+		age:
+		  - ` + testAgeRecipient + `
+		encryptedRegex: ^(data|stringData)$
+		previous:
+		  - previous.yaml
+		`)
+
+	encryptSecret := func(config string, password string) *yaml.RNode {
+		m := newResMap(require, `
+			apiVersion: v1
+			kind: Secret
+			metadata:
+			  name: app-secret
+			  annotations:
+			    internal.config.kubernetes.io/path: secrets/app-secret.yaml
+			stringData:
+			  username: admin
+			  password: `+password+`
+			`)
+		transformer := NewSopsEncryptTransformerPlugin()
+		require.NoError(transformer.Config(h, []byte(config)))
+		require.NoError(transformer.Transform(m))
+		require.Equal(1, m.Size())
+		return &m.Resources()[0].RNode
+	}
+	value := func(node *yaml.RNode, path ...string) string {
+		field, err := node.Pipe(yaml.Lookup(path...))
+		require.NoError(err)
+		require.NotNil(field)
+		return yaml.GetValue(field)
+	}
+	save := func(node *yaml.RNode) string {
+		saved := node.Copy()
+		_, err := removeInternalAnnotations(saved)
+		require.NoError(err)
+		content, err := saved.String()
+		require.NoError(err)
+		require.NoError(os.WriteFile(filepath.Join(dir, "previous.yaml"), []byte(content), 0o600))
+		return content
+	}
+
+	// No previous version, the file is ignored
+	require.NoError(os.WriteFile(filepath.Join(dir, "previous.yaml"), []byte{}, 0o600))
+	encrypted := encryptSecret(config, "secret1")
+	require.Equal("app-secret", encrypted.GetName())
+	require.Equal("secrets/app-secret.yaml", encrypted.GetAnnotations()["internal.config.kubernetes.io/path"])
+	require.True(strings.HasPrefix(value(encrypted, "stringData", "password"), "ENC[AES256_GCM,"))
+	require.Equal("^(data|stringData)$", value(encrypted, "sops", "encrypted_regex"))
+	require.Equal(testAgeRecipient, value(encrypted, "sops", "age", "0", "recipient"))
+
+	content := save(encrypted)
+	nodes, err := Decrypt([]byte(content), formats.Yaml, "previous.yaml", false)
+	require.NoError(err)
+	require.Len(nodes, 1)
+	require.Equal("secret1", value(nodes[0], "stringData", "password"))
+
+	// Same values give the same document
+	reencrypted := encryptSecret(config, "secret1")
+	recontent := save(reencrypted)
+	require.Equal(content, recontent)
+
+	// Only changed values get a new ciphertext
+	changed := encryptSecret(config, "secret2")
+	require.Equal(value(encrypted, "stringData", "username"), value(changed, "stringData", "username"))
+	require.NotEqual(value(encrypted, "stringData", "password"), value(changed, "stringData", "password"))
+	require.NotEqual(value(encrypted, "sops", "mac"), value(changed, "sops", "mac"))
+	changedContent := save(changed)
+	nodes, err = Decrypt([]byte(changedContent), formats.Yaml, "previous.yaml", false)
+	require.NoError(err)
+	require.Equal("secret2", value(nodes[0], "stringData", "password"))
+
+	// Recipients are taken from the creation rules
+	require.NoError(os.WriteFile(filepath.Join(dir, ".sops.yaml"), []byte(dedent.Dedent(`
+		creation_rules:
+		  - path_regex: ^other/.*
+		    pgp: 85D77543B3D624B63CEA9E6DBC17301B491B3F21
+		  - path_regex: ^secrets/.*\.yaml$
+		    age: `+testAgeRecipient+`
+		    unencrypted_suffix: _unencrypted
+		`)), 0o600))
+	for _, ruleConfig := range []string{"", "configFile: .sops.yaml\n"} {
+		// The configuration file is looked for from the kustomization root
+		ruled := encryptSecret("targets:\n  - kind: Secret\n"+ruleConfig, "secret1")
+		require.Equal("_unencrypted", value(ruled, "sops", "unencrypted_suffix"))
+		require.Equal(testAgeRecipient, value(ruled, "sops", "age", "0", "recipient"))
+		require.True(strings.HasPrefix(value(ruled, "stringData", "username"), "ENC["))
+	}
+
+	transformer := NewSopsEncryptTransformerPlugin()
+	require.Error(transformer.Config(h, []byte("encryptedRegex: ^data$\nunencryptedSuffix: _clear\n")))
+}
+
+func TestSopsEncryptTransformer(t *testing.T) {
+	suite.Run(t, new(SopsEncryptTransformerTestSuite))
+}
@@ -1,16 +1,21 @@
 package extras
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
 
+	"github.com/go-ini/ini"
 	"github.com/kaweezle/krmfnbuiltin/pkg/utils"
 	"github.com/pkg/errors"
+	"go.mozilla.org/sops/v3"
 	"go.mozilla.org/sops/v3/aes"
 	"go.mozilla.org/sops/v3/cmd/sops/common"
 	"go.mozilla.org/sops/v3/cmd/sops/formats"
-	"go.mozilla.org/sops/v3/keyservice"
 	"sigs.k8s.io/kustomize/api/resmap"
 	"sigs.k8s.io/kustomize/kyaml/kio"
+	kyaml_utils "sigs.k8s.io/kustomize/kyaml/utils"
 	yaml "sigs.k8s.io/kustomize/kyaml/yaml"
 	oyaml "sigs.k8s.io/yaml"
 )
@@ -21,54 +26,406 @@ const (
 	c
 )
 
+// SopsSecret maps a subtree of the decrypted inline spec to a Secret.
+type SopsSecret struct {
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// The secret type. Defaults to Opaque.
+	Type        string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+
+	// Path of the decrypted mapping containing the secret values. Extended
+	// paths are allowed.
+	FieldPath string `json:"fieldPath" yaml:"fieldPath"`
+
+	// Secret keys and paths of their values, relative to FieldPath. If empty,
+	// all the entries of the mapping are used.
+	Keys map[string]string `json:"keys,omitempty" yaml:"keys,omitempty"`
+
+	// If true, the values are written unencoded in stringData instead of data.
+	StringData bool `json:"stringData,omitempty" yaml:"stringData,omitempty"`
+}
+
+// values returns the secret values in source. Structured values are encoded
+// in JSON.
+func (s *SopsSecret) values(source *yaml.RNode) (map[string]string, error) {
+	extendedPath, err := NewExtendedPath(kyaml_utils.SmarterPathSplitter(s.FieldPath, "."))
+	if err != nil {
+		return nil, err
+	}
+	root, err := extendedPath.Get(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while getting %s", s.FieldPath)
+	}
+	if root == nil {
+		return nil, fmt.Errorf("field %s not found", s.FieldPath)
+	}
+
+	nodes := map[string]*yaml.RNode{}
+	if len(s.Keys) == 0 {
+		if root.YNode().Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("field %s is not a mapping", s.FieldPath)
+		}
+		err = root.VisitFields(func(node *yaml.MapNode) error {
+			nodes[yaml.GetValue(node.Key)] = node.Value
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for key, path := range s.Keys {
+		node, err := root.Pipe(yaml.Lookup(kyaml_utils.SmarterPathSplitter(path, ".")...))
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, fmt.Errorf("field %s not found in %s", path, s.FieldPath)
+		}
+		nodes[key] = node
+	}
+
+	values := map[string]string{}
+	for key, node := range nodes {
+		if values[key], err = flatValue(node); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// flatValue returns the value of node as a string. Structured values are
+// encoded in JSON.
+func flatValue(node *yaml.RNode) (string, error) {
+	if node.YNode().Kind == yaml.ScalarNode {
+		return yaml.GetValue(node), nil
+	}
+	value, err := templateValue(node)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// secret returns the Secret built from the values of source.
+func (s *SopsSecret) secret(source *yaml.RNode) (*yaml.RNode, error) {
+	values, err := s.values(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while building secret %s", s.Name)
+	}
+
+	secret := yaml.NewRNode(&yaml.Node{Kind: yaml.MappingNode})
+	secret.SetApiVersion("v1")
+	secret.SetKind("Secret")
+	if err := secret.SetName(s.Name); err != nil {
+		return nil, err
+	}
+	if s.Namespace != "" {
+		if err := secret.SetNamespace(s.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	if err := secret.SetLabels(s.Labels); err != nil {
+		return nil, err
+	}
+	if err := secret.SetAnnotations(s.Annotations); err != nil {
+		return nil, err
+	}
+	secretType := s.Type
+	if secretType == "" {
+		secretType = "Opaque"
+	}
+	if err := secret.PipeE(yaml.SetField("type", yaml.NewStringRNode(secretType))); err != nil {
+		return nil, err
+	}
+
+	field := yaml.DataField
+	if s.StringData {
+		field = "stringData"
+	}
+	data := yaml.NewRNode(&yaml.Node{Kind: yaml.MappingNode})
+	for _, key := range yaml.SortedMapKeys(values) {
+		value := values[key]
+		if !s.StringData {
+			value = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		if err := data.PipeE(yaml.SetField(key, yaml.NewStringRNode(value))); err != nil {
+			return nil, err
+		}
+	}
+	if err := secret.PipeE(yaml.SetField(field, data)); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// SopsFileWrapper configures the resources wrapping the decrypted content of
+// files that don't contain KRM resources (dotenv, INI, binary, plain YAML or
+// JSON files).
+type SopsFileWrapper struct {
+	// Kind of the resources: ConfigMap, Secret or PlatformSecrets (default).
+	// PlatformSecrets resources keep the structure of the content and are
+	// injected like heredoc resources.
+	Kind      string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+}
+
+// Validate checks the wrapper kind.
+func (w *SopsFileWrapper) Validate() error {
+	switch w.Kind {
+	case "", defaultKind, "ConfigMap", "Secret":
+		return nil
+	}
+	return fmt.Errorf("invalid wrapper kind %q, expected ConfigMap, Secret or %s", w.Kind, defaultKind)
+}
+
+// flat returns true if the wrapping resources only contain string values.
+func (w *SopsFileWrapper) flat() bool {
+	return w.Kind == "ConfigMap" || w.Kind == "Secret"
+}
+
+// branchContent returns the string values of branch. Values that are
+// branches themselves, like INI sections, are nested or, if flat is true,
+// prefixed with their key. The keys of the INI default section are kept at
+// the top level.
+func branchContent(branch sops.TreeBranch, flat bool) (*yaml.RNode, error) {
+	content := yaml.NewMapRNode(nil)
+	for _, item := range branch {
+		key, ok := item.Key.(string)
+		if !ok {
+			// Comment
+			continue
+		}
+		switch value := item.Value.(type) {
+		case sops.TreeBranch:
+			section, err := branchContent(value, flat)
+			if err != nil {
+				return nil, err
+			}
+			if key == ini.DefaultSection || flat {
+				prefix := ""
+				if key != ini.DefaultSection {
+					prefix = key + "."
+				}
+				if err := section.VisitFields(func(node *yaml.MapNode) error {
+					return content.PipeE(yaml.SetField(prefix+yaml.GetValue(node.Key), node.Value))
+				}); err != nil {
+					return nil, err
+				}
+			} else if len(section.Content()) > 0 {
+				if err := content.PipeE(yaml.SetField(key, section)); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if err := content.PipeE(yaml.SetField(key, yaml.NewStringRNode(fmt.Sprint(value)))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return content, nil
+}
+
+// isKRM returns true if all the nodes are KRM resources.
+func isKRM(nodes []*yaml.RNode) bool {
+	for _, node := range nodes {
+		if node.YNode().Kind != yaml.MappingNode || node.GetKind() == "" || node.GetApiVersion() == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// wrap returns the resource wrapping content, named after the base name of
+// file. If binary is
+// true, the values of content are base64 encoded.
+func (w *SopsFileWrapper) wrap(file string, content *yaml.RNode, binary bool) (*yaml.RNode, error) {
+	r := yaml.NewMapRNode(nil)
+	switch w.Kind {
+	case "ConfigMap", "Secret":
+		r.SetApiVersion("v1")
+		r.SetKind(w.Kind)
+	default:
+		r.SetApiVersion(defaultApiVersion)
+		r.SetKind(defaultKind)
+		if err := r.PipeE(yaml.SetAnnotation(utils.FunctionAnnotationInjectLocal, "true")); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.SetName(filepath.Base(file)); err != nil {
+		return nil, err
+	}
+	if w.Namespace != "" {
+		if err := r.SetNamespace(w.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	if w.Kind == "Secret" {
+		if err := r.PipeE(yaml.SetField("type", yaml.NewStringRNode("Opaque"))); err != nil {
+			return nil, err
+		}
+	}
+
+	field := yaml.DataField
+	if w.Kind == "ConfigMap" && binary {
+		field = yaml.BinaryDataField
+	}
+	if w.flat() {
+		data := yaml.NewMapRNode(nil)
+		if err := content.VisitFields(func(node *yaml.MapNode) error {
+			value, err := flatValue(node.Value)
+			if err != nil {
+				return err
+			}
+			if w.Kind == "Secret" && !binary {
+				value = base64.StdEncoding.EncodeToString([]byte(value))
+			}
+			return data.PipeE(yaml.SetField(yaml.GetValue(node.Key), yaml.NewStringRNode(value)))
+		}); err != nil {
+			return nil, err
+		}
+		content = data
+	}
+	if err := r.PipeE(yaml.SetField(field, content)); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // SopsGeneratorPlugin configures the SopsGenerator.
 type SopsGeneratorPlugin struct {
 	yaml.ResourceMeta
+	SopsKeyOptions `json:",inline" yaml:",inline"`
 
 	Files []string `yaml:"files,omitempty"`
 
+	// If true, the MAC of the inline spec is verified. The MAC of files is
+	// always verified.
+	VerifyMac bool `json:"verifyMac,omitempty" yaml:"verifyMac,omitempty"`
+
 	Sops map[string]interface{} `json:"sops,omitempty" yaml:"spec,omitempty"`
 
+	// Secrets generated from the decrypted inline spec instead of the
+	// PlatformSecrets resource.
+	OutputSecrets []*SopsSecret `json:"outputSecrets,omitempty" yaml:"outputSecrets,omitempty"`
+
+	// Resources wrapping the content of the files that don't contain KRM
+	// resources.
+	WrapFiles SopsFileWrapper `json:"wrapFiles,omitempty" yaml:"wrapFiles,omitempty"`
+
 	h      *resmap.PluginHelpers
 	buffer []byte
 }
 
+// Decrypt decrypts the sops encrypted content b with the local key service
+// and returns the resources it contains.
 func Decrypt(b []byte, format formats.Format, file string, ignoreMac bool) (nodes []*yaml.RNode, err error) {
+	return DecryptWithOptions(b, format, file, ignoreMac, nil)
+}
+
+// DecryptWithOptions works like [Decrypt] but uses the keys and key services
+// configured by options.
+func DecryptWithOptions(b []byte, format formats.Format, file string, ignoreMac bool, options *SopsKeyOptions) (nodes []*yaml.RNode, err error) {
+	_, data, err := decryptTree(b, format, file, ignoreMac, options)
+	if err != nil {
+		return
+	}
+
+	nodes, err = kio.FromBytes(data)
+	if err != nil {
+		err = errors.Wrapf(err, "Error while reading decrypted resources from file %s", file)
+	}
+	return
+}
+
+// decryptTree decrypts the sops encrypted content b and returns the decrypted
+// tree and its plaintext.
+func decryptTree(b []byte, format formats.Format, file string, ignoreMac bool, options *SopsKeyOptions) (*sops.Tree, []byte, error) {
 
 	store := common.StoreForFormat(format)
 
 	// Load SOPS file and access the data key
 	tree, err := store.LoadEncryptedFile(b)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if err = options.filterKeyGroups(&tree.Metadata); err != nil {
+		return nil, nil, err
+	}
+	keyServices, closeKeyServices, err := options.keyServices()
+	if err != nil {
+		return nil, nil, err
 	}
+	defer closeKeyServices()
 
 	_, err = common.DecryptTree(common.DecryptTreeOpts{
-		KeyServices: []keyservice.KeyServiceClient{
-			keyservice.NewLocalClient(),
-		},
-		Tree:      &tree,
-		IgnoreMac: ignoreMac,
-		Cipher:    aes.NewCipher(),
+		KeyServices: keyServices,
+		Tree:        &tree,
+		IgnoreMac:   ignoreMac,
+		Cipher:      aes.NewCipher(),
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	var data []byte
+	data, err := store.EmitPlainFile(tree.Branches)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "trouble decrypting file %s", file)
+	}
+	return &tree, data, nil
+}
 
-	data, err = store.EmitPlainFile(tree.Branches)
+// decryptFile decrypts the sops encrypted file content b and returns the
+// resources it contains. Dotenv, INI and binary files, as well as YAML and
+// JSON files not containing KRM resources, are wrapped in a resource. The
+// keys of the resource are the dotenv and INI entries, the top level fields
+// of YAML and JSON files and, for binary files, the file name with the base64
+// encoded content as value.
+func (p *SopsGeneratorPlugin) decryptFile(b []byte, file string) ([]*yaml.RNode, error) {
+	format := formats.FormatForPath(file)
+	tree, data, err := decryptTree(b, format, file, false, &p.SopsKeyOptions)
 	if err != nil {
-		err = errors.Wrapf(err, "trouble decrypting file %s", file)
-		return
+		return nil, err
 	}
 
-	nodes, err = kio.FromBytes(data)
+	var content *yaml.RNode
+	binary := false
+	switch format {
+	case formats.Binary:
+		content = yaml.NewMapRNode(&map[string]string{
+			filepath.Base(file): base64.StdEncoding.EncodeToString(data),
+		})
+		binary = true
+	case formats.Dotenv, formats.Ini:
+		if content, err = branchContent(tree.Branches[0], p.WrapFiles.flat()); err != nil {
+			return nil, err
+		}
+	default:
+		nodes, err := kio.FromBytes(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error while reading decrypted resources from file %s", file)
+		}
+		if isKRM(nodes) {
+			return nodes, nil
+		}
+		if len(nodes) != 1 || nodes[0].YNode().Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("file %s contains neither KRM resources nor a single mapping", file)
+		}
+		content = nodes[0]
+	}
+
+	r, err := p.WrapFiles.wrap(file, content, binary)
 	if err != nil {
-		err = errors.Wrapf(err, "Error while reading decrypted resources from file %s", file)
+		return nil, errors.Wrapf(err, "while wrapping file %s", file)
 	}
-	return
+	return []*yaml.RNode{r}, nil
 }
 
 // Config reads the function configuration, i.e. the kustomizeDirectory
@@ -77,14 +434,45 @@ func (p *SopsGeneratorPlugin) Config(h *resmap.PluginHelpers, c []byte) (err err
 	if err != nil {
 		return
 	}
+	if err = p.SopsKeyOptions.Validate(); err != nil {
+		return
+	}
+	if err = p.WrapFiles.Validate(); err != nil {
+		return
+	}
 	p.h = h
 	if p.Sops != nil {
 		p.buffer = c
+		if p.VerifyMac {
+			// The internal annotations are not part of the encrypted content
+			var node *yaml.RNode
+			if node, err = yaml.Parse(string(c)); err != nil {
+				return
+			}
+			if _, err = removeInternalAnnotations(node); err != nil {
+				return
+			}
+			var content string
+			if content, err = node.String(); err != nil {
+				return
+			}
+			p.buffer = []byte(content)
+		}
 	} else {
 		if p.Files == nil {
 			err = fmt.Errorf("generator configuration doesn't contain any file")
 			return
 		}
+		if len(p.OutputSecrets) > 0 {
+			err = fmt.Errorf("outputSecrets can only be used with an inline spec")
+			return
+		}
+	}
+	for i, secret := range p.OutputSecrets {
+		if secret == nil || secret.Name == "" || secret.FieldPath == "" {
+			err = fmt.Errorf("output secret %d must have a name and a fieldPath", i)
+			return
+		}
 	}
 	return
 }
@@ -95,11 +483,23 @@ func (p *SopsGeneratorPlugin) Generate() (resmap.ResMap, error) {
 	if p.buffer != nil {
 		name := p.GetIdentifier().Name
 		var err error
-		nodes, err = Decrypt(p.buffer, formats.Yaml, name, true)
+		nodes, err = DecryptWithOptions(p.buffer, formats.Yaml, name, !p.VerifyMac, &p.SopsKeyOptions)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error decoding manifest %q, content -->%s<--", name, string(p.buffer))
 		}
 
+		if len(p.OutputSecrets) > 0 {
+			secrets := []*yaml.RNode{}
+			for _, secret := range p.OutputSecrets {
+				node, err := secret.secret(nodes[0])
+				if err != nil {
+					return nil, err
+				}
+				secrets = append(secrets, node)
+			}
+			return utils.ResourceMapFromNodes(secrets), nil
+		}
+
 		for _, r := range nodes {
 			r.SetKind(defaultKind)
 			r.SetApiVersion(defaultApiVersion)
@@ -117,8 +517,7 @@ func (p *SopsGeneratorPlugin) Generate() (resmap.ResMap, error) {
 				return nil, errors.Wrapf(err, "error reading manifest %q", file)
 			}
 
-			format := formats.FormatForPath(file)
-			fileNodes, err := Decrypt(b, format, file, false)
+			fileNodes, err := p.decryptFile(b, file)
 			if err != nil {
 				return nil, errors.Wrapf(err, "error decrypting file %q", file)
 			}
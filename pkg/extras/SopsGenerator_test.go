@@ -0,0 +1,375 @@
+package extras
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/stretchr/testify/suite"
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"go.mozilla.org/sops/v3/keyservice"
+	"google.golang.org/grpc"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+type SopsGeneratorTestSuite struct {
+	suite.Suite
+}
+
+func (s *SopsGeneratorTestSuite) TestSopsGeneratorKeyOptions() {
+	require := s.Require()
+	s.T().Setenv("SOPS_AGE_KEY", testAgeIdentity)
+	dir := s.T().TempDir()
+
+	generate := func(config string) (string, error) {
+		generator := NewSopsGeneratorPlugin()
+		if err := generator.Config(nil, []byte(config)); err != nil {
+			return "", err
+		}
+		m, err := generator.Generate()
+		if err != nil {
+			return "", err
+		}
+		password, err := m.Resources()[0].Pipe(yaml.Lookup("secrets", "password"))
+		require.NoError(err)
+		return yaml.GetValue(password), nil
+	}
+	// Adds the annotation set by kustomize on function configurations
+	withIndex := func(config string) string {
+		node, err := yaml.Parse(config)
+		require.NoError(err)
+		require.NoError(node.PipeE(yaml.SetAnnotation("internal.config.kubernetes.io/index", "0")))
+		result, err := node.String()
+		require.NoError(err)
+		return result
+	}
+
+	// Returns a configuration with an inline spec encrypted for the test age
+	// recipient.
+	encryptedGeneratorConfig := func(options string) string {
+		m := newResMap(require, dedent.Dedent(`
+			apiVersion: krmfnbuiltin.kaweezle.com/v1alpha1
+			kind: SopsGenerator
+			metadata:
+			  name: secrets
+			  annotations:
+			    config.kubernetes.io/function: |
+			      exec:
+			        path: krmfnbuiltin
+			secrets:
+			  password: secret1
+			`)+options)
+		transformer := NewSopsEncryptTransformerPlugin()
+		require.NoError(transformer.Config(nil, []byte("targets:\n  - kind: SopsGenerator\nage:\n  - "+testAgeRecipient+"\nencryptedRegex: ^secrets$\n")))
+		require.NoError(transformer.Transform(m))
+		content, err := m.Resources()[0].RNode.String()
+		require.NoError(err)
+		return content
+	}
+
+	config := encryptedGeneratorConfig("verifyMac: true\nkeyTypes:\n  - age\n")
+	password, err := generate(withIndex(config))
+	require.NoError(err)
+	require.Equal("secret1", password)
+
+	tampered := strings.Replace(config, "path: krmfnbuiltin", "path: other", 1)
+	_, err = generate(tampered)
+	require.Error(err)
+	require.Contains(err.Error(), "MAC mismatch")
+	password, err = generate(strings.Replace(encryptedGeneratorConfig(""), "path: krmfnbuiltin", "path: other", 1))
+	require.NoError(err, "the MAC is not verified by default")
+	require.Equal("secret1", password)
+
+	_, err = generate(encryptedGeneratorConfig("keyTypes:\n  - pgp\n"))
+	require.Error(err)
+	require.Contains(err.Error(), "no key of type pgp")
+	_, err = generate(encryptedGeneratorConfig("keyTypes:\n  - ssh\n"))
+	require.Error(err)
+
+	// Age identities from another environment variable or a file
+	require.NoError(os.Unsetenv("SOPS_AGE_KEY"))
+	s.T().Setenv("SOPS_AGE_KEY_FILE", filepath.Join(dir, "missing.txt"))
+	s.T().Setenv("APP_AGE_KEY", testAgeIdentity)
+	_, err = generate(encryptedGeneratorConfig(""))
+	require.Error(err)
+	password, err = generate(encryptedGeneratorConfig("ageKeyEnv: APP_AGE_KEY\n"))
+	require.NoError(err)
+	require.Equal("secret1", password)
+	require.NoError(os.WriteFile(filepath.Join(dir, "keys.txt"), []byte("# test key\n"+testAgeIdentity+"\n"), 0o600))
+	password, err = generate(encryptedGeneratorConfig("ageKeyFile: " + filepath.Join(dir, "keys.txt") + "\ndisableLocalKeyService: true\n"))
+	require.NoError(err)
+	require.Equal("secret1", password)
+
+	// Remote key service listening on a unix socket
+	socket := filepath.Join(dir, "keyservice.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(err)
+	server := grpc.NewServer()
+	keyservice.RegisterKeyServiceServer(server, keyservice.Server{})
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+	s.T().Setenv("SOPS_AGE_KEY", testAgeIdentity)
+	password, err = generate(encryptedGeneratorConfig("keyServices:\n  - unix://" + socket + "\ndisableLocalKeyService: true\n"))
+	require.NoError(err)
+	require.Equal("secret1", password)
+	services, closeKeyServices, err := (&SopsKeyOptions{KeyServices: []string{"unix://" + socket}, DisableLocalKeyService: true}).keyServices()
+	require.NoError(err)
+	require.Len(services, 1)
+	closeKeyServices()
+	_, err = services[0].Decrypt(context.Background(), &keyservice.DecryptRequest{})
+	require.ErrorContains(err, "closing", "the key service connections should be closed")
+	_, err = generate(encryptedGeneratorConfig("keyServices:\n  - http://localhost:5000\n"))
+	require.Error(err)
+}
+
+func (s *SopsGeneratorTestSuite) TestSopsGeneratorSecretsOutput() {
+	require := s.Require()
+	s.T().Setenv("SOPS_AGE_KEY", testAgeIdentity)
+
+	m := newResMap(require, `
+		apiVersion: krmfnbuiltin.kaweezle.com/v1alpha1
+		kind: SopsGenerator
+		metadata:
+		  name: secrets
+		outputSecrets:
+		  - name: argocd-secret
+		    namespace: argocd
+		    fieldPath: secrets.argocd
+		    stringData: true
+		    labels:
+		      app.kubernetes.io/part-of: argocd
+		  - name: registry
+		    type: kubernetes.io/dockerconfigjson
+		    fieldPath: secrets
+		    keys:
+		      .dockerconfigjson: registry
+		  - name: tls
+		    type: kubernetes.io/tls
+		    fieldPath: secrets.tls
+		    annotations:
+		      replicator.v1.mittwald.de/replicate-to: "*"
+		secrets:
+		  argocd:
+		    admin.password: secret1
+		    server.port: 8080
+		  registry:
+		    auths:
+		      ghcr.io:
+		        auth: dXNlcjpwYXNz
+		  tls:
+		    tls.crt: certificate
+		    tls.key: key
+		`)
+	transformer := NewSopsEncryptTransformerPlugin()
+	require.NoError(transformer.Config(nil, []byte("targets:\n  - kind: SopsGenerator\nage:\n  - "+testAgeRecipient+"\nencryptedRegex: ^secrets$\n")))
+	require.NoError(transformer.Transform(m))
+	config, err := m.Resources()[0].RNode.String()
+	require.NoError(err)
+
+	generator := NewSopsGeneratorPlugin()
+	require.NoError(generator.Config(nil, []byte(config)))
+	generated, err := generator.Generate()
+	require.NoError(err)
+	require.Equal(3, generated.Size())
+	actual, err := generated.AsYaml()
+	require.NoError(err)
+	require.Equal(dedent.Dedent(`
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  labels:
+		    app.kubernetes.io/part-of: argocd
+		  name: argocd-secret
+		  namespace: argocd
+		stringData:
+		  admin.password: secret1
+		  server.port: "8080"
+		type: Opaque
+		---
+		apiVersion: v1
+		data:
+		  .dockerconfigjson: eyJhdXRocyI6eyJnaGNyLmlvIjp7ImF1dGgiOiJkWE5sY2pwd1lYTnoifX19
+		kind: Secret
+		metadata:
+		  name: registry
+		type: kubernetes.io/dockerconfigjson
+		---
+		apiVersion: v1
+		data:
+		  tls.crt: Y2VydGlmaWNhdGU=
+		  tls.key: a2V5
+		kind: Secret
+		metadata:
+		  annotations:
+		    replicator.v1.mittwald.de/replicate-to: '*'
+		  name: tls
+		type: kubernetes.io/tls
+		`)[1:], string(actual))
+
+	generator = NewSopsGeneratorPlugin()
+	require.Error(generator.Config(nil, []byte("files:\n  - secrets.yaml\noutputSecrets:\n  - name: secret\n    fieldPath: data\n")))
+}
+
+func (s *SopsGeneratorTestSuite) TestSopsGeneratorFileFormats() {
+	require := s.Require()
+	s.T().Setenv("SOPS_AGE_KEY", testAgeIdentity)
+	dir := s.T().TempDir()
+	h := pluginHelpers(require, dir)
+
+	// Encrypts plaintext with the test age recipient in the store matching
+	// the extension of file and writes it in dir.
+	writeSopsFile := func(file string, plaintext string) {
+		store := common.StoreForFormat(formats.FormatForPath(file))
+		branches, err := store.LoadPlainFile([]byte(plaintext))
+		require.NoError(err)
+		keys, err := age.MasterKeysFromRecipients(testAgeRecipient)
+		require.NoError(err)
+		tree := sops.Tree{Branches: branches, Metadata: sops.Metadata{
+			KeyGroups: []sops.KeyGroup{{keys[0]}},
+			Version:   "3.7.3",
+		}}
+		dataKey, errs := tree.GenerateDataKey()
+		require.Empty(errs)
+		require.NoError(common.EncryptTree(common.EncryptTreeOpts{DataKey: dataKey, Tree: &tree, Cipher: aes.NewCipher()}))
+		encrypted, err := store.EmitEncryptedFile(tree)
+		require.NoError(err)
+		require.NoError(os.WriteFile(filepath.Join(dir, file), encrypted, 0o600))
+	}
+
+	writeSopsFile("app.env", "USERNAME=admin\nPASSWORD=secret1\n")
+	writeSopsFile("app.ini", "debug = true\n\n[database]\nuser = admin\npassword = secret2\n")
+	writeSopsFile("config.json", `{"token": "secret3", "registry": {"url": "ghcr.io"}}`)
+	writeSopsFile("keystore.bin", "\x00\x01binary")
+	writeSopsFile("secret.yaml", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: secret\nstringData:\n  password: secret4\n")
+	files := "files:\n  - app.env\n  - app.ini\n  - config.json\n  - keystore.bin\n  - secret.yaml\n"
+	binary := base64.StdEncoding.EncodeToString([]byte("\x00\x01binary"))
+
+	generate := func(config string) string {
+		generator := NewSopsGeneratorPlugin()
+		require.NoError(generator.Config(h, []byte(config)))
+		m, err := generator.Generate()
+		require.NoError(err)
+		content, err := m.AsYaml()
+		require.NoError(err)
+		return string(content)
+	}
+
+	expected := dedent.Dedent(`
+		apiVersion: config.kaweezle.com/v1alpha1
+		data:
+		  PASSWORD: secret1
+		  USERNAME: admin
+		kind: PlatformSecrets
+		metadata:
+		  annotations:
+		    config.kaweezle.com/inject-local: "true"
+		  name: app.env
+		---
+		apiVersion: config.kaweezle.com/v1alpha1
+		data:
+		  database:
+		    password: secret2
+		    user: admin
+		  debug: "true"
+		kind: PlatformSecrets
+		metadata:
+		  annotations:
+		    config.kaweezle.com/inject-local: "true"
+		  name: app.ini
+		---
+		apiVersion: config.kaweezle.com/v1alpha1
+		data:
+		  registry:
+		    url: ghcr.io
+		  token: secret3
+		kind: PlatformSecrets
+		metadata:
+		  annotations:
+		    config.kaweezle.com/inject-local: "true"
+		  name: config.json
+		---
+		apiVersion: config.kaweezle.com/v1alpha1
+		data:
+		  keystore.bin: ` + binary + `
+		kind: PlatformSecrets
+		metadata:
+		  annotations:
+		    config.kaweezle.com/inject-local: "true"
+		  name: keystore.bin
+		---
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: secret
+		stringData:
+		  password: secret4
+		`)[1:]
+	require.Equal(expected, generate(files))
+
+	expected = dedent.Dedent(`
+		apiVersion: v1
+		data:
+		  PASSWORD: secret1
+		  USERNAME: admin
+		kind: ConfigMap
+		metadata:
+		  name: app.env
+		  namespace: apps
+		---
+		apiVersion: v1
+		data:
+		  database.password: secret2
+		  database.user: admin
+		  debug: "true"
+		kind: ConfigMap
+		metadata:
+		  name: app.ini
+		  namespace: apps
+		---
+		apiVersion: v1
+		data:
+		  registry: '{"url":"ghcr.io"}'
+		  token: secret3
+		kind: ConfigMap
+		metadata:
+		  name: config.json
+		  namespace: apps
+		---
+		apiVersion: v1
+		binaryData:
+		  keystore.bin: ` + binary + `
+		kind: ConfigMap
+		metadata:
+		  name: keystore.bin
+		  namespace: apps
+		---
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: secret
+		stringData:
+		  password: secret4
+		`)[1:]
+	require.Equal(expected, generate(files+"wrapFiles:\n  kind: ConfigMap\n  namespace: apps\n"))
+
+	secrets := generate("files:\n  - app.env\n  - keystore.bin\nwrapFiles:\n  kind: Secret\n")
+	require.Contains(secrets, "  PASSWORD: "+base64.StdEncoding.EncodeToString([]byte("secret1"))+"\n")
+	require.Contains(secrets, "  keystore.bin: "+binary+"\n")
+	require.Contains(secrets, "type: Opaque\n")
+
+	generator := NewSopsGeneratorPlugin()
+	require.Error(generator.Config(h, []byte(files+"wrapFiles:\n  kind: Deployment\n")))
+}
+
+func TestSopsGenerator(t *testing.T) {
+	suite.Run(t, new(SopsGeneratorTestSuite))
+}
@@ -1,6 +1,12 @@
 /*
 Package extras contains additional utility transformers and generators.
 
+[ChecksumTransformerPlugin] annotates the pod templates of workloads with a
+checksum of the ConfigMaps and Secrets they use.
+
+[SopsEncryptTransformerPlugin] encrypts resources with sops, keeping the
+ciphertext of the values that didn't change.
+
 [GitConfigMapGeneratorPlugin] is identical to ConfigMapGeneratorPlugin
 but automatically creates two properties when run inside a git repository:
 
@@ -43,7 +49,14 @@ extended transformer supports the following encodings:
   - JSON
   - TOML
   - INI
+  - XML
+  - Java properties
+  - dotenv
+  - HCL
+  - PEM
   - base64
+  - gzip and zlib
+  - sops encrypted YAML and JSON
   - Plain text (with Regexp)
 */
 package extras
@@ -9,8 +9,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/go-ini/ini"
-	"github.com/pelletier/go-toml/v2"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
@@ -25,6 +23,7 @@ import (
 //   - It is first initialized with SetPayload with the data structure payload.
 //   - Traversal is done with Get
 //   - Modification of part of the structure is done through Set
+//   - Removal of part of the structure is done through Delete
 //   - After modification, the modified payload is retrieved with GetPayload
 type Extender interface {
 	// SetPayload initialize the embedded data structure with payload.
@@ -37,6 +36,32 @@ type Extender interface {
 	// in the appropriate encoding or can be encoded by the Extender. Please
 	// see the Extender documentation to see how the the value is treated.
 	Set(path []string, value any) error
+	// Delete removes the part of the data structure at path.
+	Delete(path []string) error
+}
+
+// NodeExtender is an [Extender] able to return the structured value at a path
+// instead of its encoded representation. It allows using structured values of
+// embedded content as replacement sources.
+type NodeExtender interface {
+	Extender
+	// GetNode returns the node at path. Scalar values are returned as scalar
+	// nodes.
+	GetNode(path []string) (*yaml.RNode, error)
+}
+
+// pathNotFoundError is returned by extenders when the path they are given
+// doesn't exist in their payload.
+type pathNotFoundError string
+
+func (e pathNotFoundError) Error() string {
+	return string(e)
+}
+
+// isPathNotFound returns true if err is or wraps a [pathNotFoundError].
+func isPathNotFound(err error) bool {
+	var notFound pathNotFoundError
+	return errors.As(err, &notFound)
 }
 
 // ExtendedSegment contains the path segment of a resource inside an embedded
@@ -74,6 +99,14 @@ const (
 	JsonExtender
 	TomlExtender
 	IniExtender
+	XmlExtender
+	PropertiesExtender
+	EnvExtender
+	HclExtender
+	GzipExtender
+	ZlibExtender
+	PemExtender
+	SopsExtender
 )
 
 // stringToExtenderTypeMap maps encoding names to the corresponding extender
@@ -120,12 +153,21 @@ func getExtenderType(n string) ExtenderType {
 // YAML Extender
 ////////////////
 
+// yamlDocument is one of the documents of a YAML payload.
+type yamlDocument struct {
+	prefix   string // separator and empty documents preceding the document
+	body     string // source text of the document
+	node     *yaml.RNode
+	modified bool
+}
+
 // yamlExtender manages embedded YAML in KRM resources.
 //
-// Internally, it uses a RNode. It avoids additional dependencies and preserves
-// ordering and comments.
+// Internally, it uses a RNode per document. It avoids additional dependencies
+// and preserves ordering and comments.
 type yamlExtender struct {
-	node *yaml.RNode
+	documents []*yamlDocument
+	suffix    string // trailing empty documents
 }
 
 // parsePayload parses payload into a RNode.
@@ -142,13 +184,76 @@ func parsePayload(payload []byte) (*yaml.RNode, error) {
 	if err != nil {
 		return nil, errors.WrapPrefixf(err, "while reading payload")
 	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("payload contains no document")
+	}
 	return nodes[0], nil
 }
 
-// SetPayload parses payload an sets the extender internal state
-func (e *yamlExtender) SetPayload(payload []byte) (err error) {
-	e.node, err = parsePayload(payload)
-	return
+// yamlDocumentSeparator matches a YAML document separator line. The content
+// following the separator on the same line, like a tag or a flow mapping,
+// belongs to the document.
+var yamlDocumentSeparator = regexp.MustCompile(`^---(?:[ \t]+(?:#.*)?|$)`)
+
+// SetPayload splits payload into documents, parses them and sets the extender
+// internal state.
+//
+// The source text of each document is kept so that the documents that are not
+// modified are written back unchanged.
+func (e *yamlExtender) SetPayload(payload []byte) error {
+	e.documents = []*yamlDocument{}
+	pending := ""
+	separator := ""
+	body := ""
+	flush := func() error {
+		node, err := parsePayload([]byte(body))
+		if err != nil {
+			if strings.TrimSpace(body) != "" && !isCommentOnly(body) {
+				return err
+			}
+			pending += separator + body
+		} else {
+			e.documents = append(e.documents, &yamlDocument{prefix: pending + separator, body: body, node: node})
+			pending = ""
+		}
+		separator, body = "", ""
+		return nil
+	}
+
+	for _, line := range strings.SplitAfter(string(payload), "\n") {
+		if match := yamlDocumentSeparator.FindString(strings.TrimRight(line, "\r\n")); match != "" {
+			if err := flush(); err != nil {
+				return err
+			}
+			separator = line[:len(match)]
+			if rest := line[len(match):]; strings.TrimSpace(rest) != "" {
+				body = rest
+			} else {
+				separator = line
+			}
+			continue
+		}
+		body += line
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if len(e.documents) == 0 {
+		return fmt.Errorf("payload contains no document")
+	}
+	e.suffix = pending
+	return nil
+}
+
+// isCommentOnly returns true if text only contains comments and blank lines.
+func isCommentOnly(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
 }
 
 // serializeNode serialize one node into YAML
@@ -158,9 +263,108 @@ func serializeNode(node *yaml.RNode) ([]byte, error) {
 	return b.Bytes(), err
 }
 
-// GetPayload returns the current payload in the proper encoding
+// GetPayload returns the current payload in the proper encoding.
+//
+// Only the modified documents are serialized. The others are returned as
+// they were in the source payload.
 func (e *yamlExtender) GetPayload() ([]byte, error) {
-	return serializeNode(e.node)
+	var b bytes.Buffer
+	for _, document := range e.documents {
+		if !document.modified {
+			b.WriteString(document.prefix)
+			b.WriteString(document.body)
+			continue
+		}
+		prefix := document.prefix
+		if prefix != "" && !strings.HasSuffix(prefix, "\n") {
+			// The document started on the separator line
+			prefix = strings.TrimRight(prefix, " \t") + "\n"
+		}
+		b.WriteString(prefix)
+		serialized, err := serializeNode(document.node)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(serialized)
+	}
+	b.WriteString(e.suffix)
+	return b.Bytes(), nil
+}
+
+// documentMatches returns true if node matches all the key=value pairs of
+// selector. The kind, apiVersion, name and namespace keys match the
+// corresponding KRM properties. Other keys are dot separated paths of fields.
+func documentMatches(node *yaml.RNode, selector string) (bool, error) {
+	for _, condition := range strings.Split(selector, ",") {
+		key, value, found := strings.Cut(condition, "=")
+		if !found {
+			return false, fmt.Errorf("invalid document selector: [%s]", selector)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		actual := ""
+		switch key {
+		case "kind":
+			actual = node.GetKind()
+		case "apiVersion":
+			actual = node.GetApiVersion()
+		case "name":
+			actual = node.GetName()
+		case "namespace":
+			actual = node.GetNamespace()
+		default:
+			field, err := node.Pipe(yaml.Lookup(strings.Split(key, ".")...))
+			if err != nil || field == nil {
+				return false, nil
+			}
+			actual = yaml.GetValue(field)
+		}
+		if actual != value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// isBareSequence returns true if node is a wrapped sequence document.
+func isBareSequence(node *yaml.RNode) bool {
+	return node.Field(yaml.BareSeqNodeWrappingKey) != nil
+}
+
+// selectDocument returns the document addressed by the first segment of path
+// and the remaining path.
+//
+// The first segment of the path can be the index of the document between
+// brackets, like [1], or a selector like [kind=Deployment,name=x]. Otherwise,
+// the first document is used, whatever the number of documents. Selectors only
+// match mapping documents. If none does and the first document is a sequence,
+// the selector applies to its elements.
+func (e *yamlExtender) selectDocument(path []string) (*yamlDocument, []string, error) {
+	if len(path) == 0 || !strings.HasPrefix(path[0], "[") || !strings.HasSuffix(path[0], "]") {
+		return e.documents[0], path, nil
+	}
+	selector := path[0][1 : len(path[0])-1]
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 0 || index >= len(e.documents) {
+			return nil, nil, pathNotFoundError(fmt.Sprintf("document index %d out of range", index))
+		}
+		return e.documents[index], path[1:], nil
+	}
+	for _, document := range e.documents {
+		if isBareSequence(document.node) {
+			continue
+		}
+		matches, err := documentMatches(document.node, selector)
+		if err != nil {
+			return nil, nil, err
+		}
+		if matches {
+			return document, path[1:], nil
+		}
+	}
+	if isBareSequence(e.documents[0].node) {
+		return e.documents[0], path, nil
+	}
+	return nil, nil, pathNotFoundError(fmt.Sprintf("no document matching %s", path[0]))
 }
 
 // unwrapSeqNode unwraps node if it is a Wrapped Bare Seq Node
@@ -193,6 +397,9 @@ func getNodePath(node *yaml.RNode, path []string, serializer nodeSerializer) ([]
 	if err != nil {
 		return nil, fmt.Errorf("error fetching elements in replacement target: %w", err)
 	}
+	if node == nil {
+		return nil, pathNotFoundError(fmt.Sprintf("path %s not found", strings.Join(path, ".")))
+	}
 
 	if node.YNode().Kind == yaml.ScalarNode {
 		return []byte(node.YNode().Value), nil
@@ -203,7 +410,163 @@ func getNodePath(node *yaml.RNode, path []string, serializer nodeSerializer) ([]
 
 // Get returns the encoded payload at the specified path
 func (e *yamlExtender) Get(path []string) ([]byte, error) {
-	return getNodePath(e.node, path, serializeNode)
+	document, path, err := e.selectDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return getNodePath(document.node, path, serializeNode)
+}
+
+// clearReaderAnnotations removes the annotations added by the kio reader on
+// the mapping node.
+func clearReaderAnnotations(node *yaml.RNode) {
+	node.Pipe(yaml.ClearAnnotation(kioutil.IndexAnnotation))
+	node.Pipe(yaml.ClearAnnotation(kioutil.LegacyIndexAnnotation))
+	node.Pipe(yaml.ClearAnnotation(kioutil.SeqIndentAnnotation))
+	yaml.ClearEmptyAnnotations(node)
+}
+
+// lookupNode returns a copy of the node at path in node. When path is empty,
+// the annotations added while reading the payload are removed from the copy.
+func lookupNode(node *yaml.RNode, path []string) (*yaml.RNode, error) {
+	result, err := Lookup(node, path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, pathNotFoundError(fmt.Sprintf("path %s not found", strings.Join(path, ".")))
+	}
+	result = result.Copy()
+	if len(path) == 0 && result.YNode().Kind == yaml.MappingNode {
+		clearReaderAnnotations(result)
+	}
+	return result, nil
+}
+
+// removeChild removes the child of parent addressed by segment. segment can be
+// a mapping key, a sequence index or a [key=value] sequence element selector.
+// Nothing is done if there is no such child.
+func removeChild(parent *yaml.RNode, segment string) error {
+	switch parent.YNode().Kind {
+	case yaml.MappingNode:
+		return parent.PipeE(yaml.Clear(segment))
+	case yaml.SequenceNode:
+		if yaml.IsListIndex(segment) {
+			key, value, err := yaml.SplitIndexNameValue(segment)
+			if err != nil {
+				return err
+			}
+			return parent.PipeE(yaml.ElementSetter{Keys: []string{key}, Values: []string{value}})
+		}
+		index, err := strconv.Atoi(segment)
+		if err != nil {
+			return fmt.Errorf("invalid sequence index %s", segment)
+		}
+		content := parent.YNode().Content
+		if index >= 0 && index < len(content) {
+			parent.YNode().Content = append(content[:index], content[index+1:]...)
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot remove %s from a scalar", segment)
+}
+
+// deleteNodePath removes the node at path in node. Nothing is done if the
+// path doesn't exist.
+func deleteNodePath(node *yaml.RNode, path []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("cannot delete empty path")
+	}
+	parent, err := Lookup(node, path[:len(path)-1], 0)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return nil
+	}
+	return removeChild(parent, path[len(path)-1])
+}
+
+// appendNode returns the result of appending value to current. If current is
+// a sequence, value is added at its end, or its elements if value is also a
+// sequence. If current is a scalar, value is concatenated to it.
+func appendNode(current *yaml.RNode, value *yaml.RNode) (*yaml.RNode, error) {
+	result := current.Copy()
+	switch current.YNode().Kind {
+	case yaml.SequenceNode:
+		added := value.Copy().YNode()
+		if added.Kind == yaml.SequenceNode {
+			result.YNode().Content = append(result.YNode().Content, added.Content...)
+		} else {
+			result.YNode().Content = append(result.YNode().Content, added)
+		}
+		return result, nil
+	case yaml.ScalarNode:
+		if value.YNode().Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("only a scalar can be appended to a scalar")
+		}
+		result.YNode().Value += value.YNode().Value
+		return result, nil
+	}
+	return nil, fmt.Errorf("cannot append to a mapping, use merge instead")
+}
+
+// mergeMapping merges the source mapping node into the target one. Nested
+// mappings are merged recursively. Other values of source replace the ones of
+// target.
+func mergeMapping(target *yaml.Node, source *yaml.Node) {
+	for i := 0; i < len(source.Content)-1; i += 2 {
+		key, value := source.Content[i], source.Content[i+1]
+		found := false
+		for j := 0; j < len(target.Content)-1; j += 2 {
+			if target.Content[j].Value != key.Value {
+				continue
+			}
+			if target.Content[j+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				mergeMapping(target.Content[j+1], value)
+			} else {
+				target.Content[j+1] = value
+			}
+			found = true
+			break
+		}
+		if !found {
+			target.Content = append(target.Content, key, value)
+		}
+	}
+}
+
+// mergeNode returns the result of merging the value mapping into the current
+// mapping.
+func mergeNode(current *yaml.RNode, value *yaml.RNode) (*yaml.RNode, error) {
+	if current.YNode().Kind != yaml.MappingNode || value.YNode().Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("merge can only be performed between mappings")
+	}
+	result := current.Copy()
+	mergeMapping(result.YNode(), value.Copy().YNode())
+	return result, nil
+}
+
+// applyNodeOperation returns the result of operation with value on current.
+func applyNodeOperation(current *yaml.RNode, value *yaml.RNode, operation Operation) (*yaml.RNode, error) {
+	switch operation {
+	case AppendOperation:
+		return appendNode(current, value)
+	case MergeOperation:
+		return mergeNode(current, value)
+	case DeleteOperation:
+		return nil, fmt.Errorf("delete operation cannot be applied on a node")
+	}
+	return value, nil
+}
+
+// GetNode returns the node at the specified path.
+func (e *yamlExtender) GetNode(path []string) (*yaml.RNode, error) {
+	document, path, err := e.selectDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return lookupNode(document.node, path)
 }
 
 // setValue sets value at path on node
@@ -234,13 +597,46 @@ func setValue(node *yaml.RNode, path []string, value any) error {
 
 // Set modifies the current payload with value at the specified path.
 func (e *yamlExtender) Set(path []string, value any) error {
-	return setValue(e.node, path, value)
+	document, path, err := e.selectDocument(path)
+	if err != nil {
+		return err
+	}
+	document.modified = true
+	return setValue(document.node, path, value)
+}
+
+// Delete removes the node at the specified path. If path only contains a
+// document selector, the whole document is removed.
+func (e *yamlExtender) Delete(path []string) error {
+	document, rest, err := e.selectDocument(path)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 && len(path) > 0 {
+		for i, d := range e.documents {
+			if d == document {
+				e.documents = append(e.documents[:i], e.documents[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+	document.modified = true
+	return deleteNodePath(document.node, rest)
 }
 
 // NewYamlExtender returns a newly created YAML [Extender].
 //
 // With this encoding, you can set scalar values (strings, numbers) as well
 // as mapping values.
+//
+// The first path segment can select the document by index between brackets
+// or with a selector. Otherwise the first document is used:
+//
+//	!!yaml.[1].spec.replicas
+//	!!yaml.[kind=Deployment,name=traefik].spec.replicas
+//
+// The documents that are not modified are written back unchanged.
 func NewYamlExtender() Extender {
 	return &yamlExtender{}
 }
@@ -288,6 +684,11 @@ func (e *base64Extender) Set(path []string, value any) error {
 	return nil
 }
 
+// Delete empties the current payload. path must be empty.
+func (e *base64Extender) Delete(path []string) error {
+	return e.Set(path, []byte{})
+}
+
 // NewBase64Extender returns a newly created Base64 extender.
 //
 // This extender doesn't allow structured traversal and modification. It just
@@ -324,16 +725,33 @@ func (e *regexExtender) GetPayload() ([]byte, error) {
 }
 
 // Get returns the text matched by the regexp contained in the first segment of
-// path.
+// path. If path contains a second segment, it returns the text of the
+// specified capture group of the first match.
 func (e *regexExtender) Get(path []string) ([]byte, error) {
-	if len(path) < 1 {
-		return nil, fmt.Errorf("path for regex should at least be one")
+	if len(path) < 1 || len(path) > 2 {
+		return nil, fmt.Errorf("path for regex should contain one or two elements")
 	}
-	re, err := regexp.Compile(path[0])
+	if len(path) == 1 {
+		re, err := regexp.Compile(path[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad regex %s", path[0])
+		}
+		return re.Find(e.text), nil
+	}
+
+	re, err := regexp.Compile("(?m)" + path[0])
 	if err != nil {
 		return nil, fmt.Errorf("bad regex %s", path[0])
 	}
-	return re.Find(e.text), nil
+	group, err := strconv.Atoi(path[1])
+	if err != nil || group < 0 || group > re.NumSubexp() {
+		return nil, fmt.Errorf("bad capturing group")
+	}
+	match := re.FindSubmatch(e.text)
+	if match == nil {
+		return nil, pathNotFoundError(fmt.Sprintf("no match for regex %s", path[0]))
+	}
+	return match[group], nil
 }
 
 // Set modifies the inner text inserting value in the capture group specified by
@@ -385,6 +803,12 @@ func (e *regexExtender) Set(path []string, value any) error {
 	return nil
 }
 
+// Delete removes the text of the capture group specified by path[1] of the
+// Regexp specified by path[0].
+func (e *regexExtender) Delete(path []string) error {
+	return e.Set(path, []byte{})
+}
+
 // NewRegexExtender returns a newly created Regexp [Extender].
 //
 // This extender allows text replacement in pure text properties. It is useful
@@ -435,10 +859,7 @@ func getJSONPayload(node *yaml.RNode) ([]byte, error) {
 	var b bytes.Buffer
 	if node.YNode().Kind == yaml.MappingNode {
 		node = node.Copy()
-		node.Pipe(yaml.ClearAnnotation(kioutil.IndexAnnotation))
-		node.Pipe(yaml.ClearAnnotation(kioutil.LegacyIndexAnnotation))
-		node.Pipe(yaml.ClearAnnotation(kioutil.SeqIndentAnnotation))
-		yaml.ClearEmptyAnnotations(node)
+		clearReaderAnnotations(node)
 	}
 	encoder := json.NewEncoder(&b)
 	encoder.SetIndent("", "  ")
@@ -457,11 +878,21 @@ func (e *jsonExtender) Get(path []string) ([]byte, error) {
 	return getNodePath(e.node, path, getJSONPayload)
 }
 
+// GetNode returns the node at the specified path.
+func (e *jsonExtender) GetNode(path []string) (*yaml.RNode, error) {
+	return lookupNode(e.node, path)
+}
+
 // Set modifies the inner JSON at path with value
 func (e *jsonExtender) Set(path []string, value any) error {
 	return setValue(e.node, path, value)
 }
 
+// Delete removes the inner JSON at path.
+func (e *jsonExtender) Delete(path []string) error {
+	return deleteNodePath(e.node, path)
+}
+
 // NewJsonExtender returns a newly created [Extender] to modify JSON content.
 //
 // As with the YAML extender (see [NewYamlExtender]), modifications are not
@@ -470,141 +901,6 @@ func NewJsonExtender() Extender {
 	return &jsonExtender{}
 }
 
-///////
-// TOML
-///////
-
-// tomlExtender is an [Extender] allowing the structured modification of a TOML
-// property.
-type tomlExtender struct {
-	node *yaml.RNode
-}
-
-// SetPayload sets the internal state with the TOML source payload.
-func (e *tomlExtender) SetPayload(payload []byte) error {
-
-	m := map[string]interface{}{}
-	err := toml.Unmarshal(payload, &m)
-	if err != nil {
-		return errors.WrapPrefixf(err, "while un-marshalling toml")
-	}
-
-	e.node, err = yaml.FromMap(m)
-	if err != nil {
-		return errors.WrapPrefixf(err, "while converting into yaml")
-	}
-
-	return nil
-}
-
-// getTOMLPayload returns the TOML representation of the specified node.
-//
-// The node must be a mapping node.
-func getTOMLPayload(node *yaml.RNode) ([]byte, error) {
-	m, err := node.Map()
-	if err != nil {
-		return nil, errors.WrapPrefixf(err, "while encoding to map")
-	}
-	return toml.Marshal(m)
-}
-
-// GetPayload return the current payload as a TOML snippet.
-func (e *tomlExtender) GetPayload() ([]byte, error) {
-	return getTOMLPayload(e.node)
-}
-
-// Get returns the TOML representation of the sub element at path.
-func (e *tomlExtender) Get(path []string) ([]byte, error) {
-	return getNodePath(e.node, path, getTOMLPayload)
-}
-
-// Set modifies the current payload at path with value.
-func (e *tomlExtender) Set(path []string, value any) error {
-	return setValue(e.node, path, value)
-}
-
-// NewTomlExtender returns a newly created [Extender] for modifying properties
-// containing TOML.
-//
-// Please be aware that this [Extender] doesn't preserve the source ordering
-// nor the comments in the content.
-func NewTomlExtender() Extender {
-	return &tomlExtender{}
-}
-
-//////
-// INI
-//////
-
-// iniExtender allows structured modification of ini file based properties.
-type iniExtender struct {
-	file *ini.File
-}
-
-// SetPayload parses payload as a INI file and set the internal state.
-func (e *iniExtender) SetPayload(payload []byte) (err error) {
-
-	e.file, err = ini.Load(payload)
-	return err
-}
-
-// GetPayload returns the current state as an ini file.
-func (e *iniExtender) GetPayload() ([]byte, error) {
-	var b bytes.Buffer
-	_, err := e.file.WriteTo(&b)
-	return b.Bytes(), err
-}
-
-// keyFromPath returns the INI key at path.
-func (e *iniExtender) keyFromPath(path []string) (*ini.Key, error) {
-	if len(path) < 1 || len(path) > 2 {
-		return nil, fmt.Errorf("invalid path length: %d", len(path))
-	}
-	section := ""
-	key := path[0]
-	if len(path) == 2 {
-		section = key
-		key = path[1]
-	}
-	return e.file.Section(section).Key(key), nil
-}
-
-// Get returns the content of the key specified by path.
-func (e *iniExtender) Get(path []string) ([]byte, error) {
-	k, err := e.keyFromPath(path)
-	if err != nil {
-		return nil, fmt.Errorf("while getting key at path %s", strings.Join(path, "."))
-	}
-	return []byte(k.String()), nil
-}
-
-// Set sets the value of the key specified by path with value.
-func (e *iniExtender) Set(path []string, value any) error {
-	k, err := e.keyFromPath(path)
-	if err != nil {
-		return fmt.Errorf("while getting key at path %s", strings.Join(path, "."))
-	}
-
-	k.SetValue(string(getByteValue(value)))
-
-	return nil
-}
-
-// NewIniExtender returns a newly created [Extender] for modifying INI files
-// like properties.
-//
-// Some tools may use ini type configuration files. This extender allows
-// modification of the values. At this point, it doesn't allow inserting
-// complete sections. If paths have one element, it will set the corresponding
-// property at the root level. If path have two elements, the first one contains
-// the section name and the second the property name.
-//
-// Please be aware that this [Extender] doesn't preserve the source ordering
-// nor the comments in the content.
-func NewIniExtender() Extender {
-	return &iniExtender{}
-}
-
 ////////////
 // Factories
 ////////////
@@ -612,12 +908,20 @@ func NewIniExtender() Extender {
 // ExtenderFactories register the [Extender] factory functions for each
 // [ExtenderType].
 var ExtenderFactories = map[ExtenderType]func() Extender{
-	YamlExtender:   NewYamlExtender,
-	Base64Extender: NewBase64Extender,
-	RegexExtender:  NewRegexExtender,
-	JsonExtender:   NewJsonExtender,
-	TomlExtender:   NewTomlExtender,
-	IniExtender:    NewIniExtender,
+	YamlExtender:       NewYamlExtender,
+	Base64Extender:     NewBase64Extender,
+	RegexExtender:      NewRegexExtender,
+	JsonExtender:       NewJsonExtender,
+	TomlExtender:       NewTomlExtender,
+	IniExtender:        NewIniExtender,
+	XmlExtender:        NewXmlExtender,
+	PropertiesExtender: NewPropertiesExtender,
+	EnvExtender:        NewEnvExtender,
+	HclExtender:        NewHclExtender,
+	GzipExtender:       NewGzipExtender,
+	ZlibExtender:       NewZlibExtender,
+	PemExtender:        NewPemExtender,
+	SopsExtender:       NewSopsExtender,
 }
 
 // Extender returns a newly created [Extender] for the appropriate encoding.
@@ -722,8 +1026,46 @@ func (ep *ExtendedPath) String() string {
 	return out
 }
 
+// getExtenderNode returns the value at path in extender as a node. If
+// extender is not a [NodeExtender], the value is returned as a string scalar.
+func getExtenderNode(extender Extender, path []string) (*yaml.RNode, error) {
+	if nodeExtender, ok := extender.(NodeExtender); ok {
+		return nodeExtender.GetNode(path)
+	}
+	value, err := extender.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.NewStringRNode(string(value)), nil
+}
+
+// applyOperation performs operation with value at path in extender.
+//
+// Append and merge operations get the current value at path, compute the
+// result and set it back. If path doesn't exist, value is set as is.
+func applyOperation(extender Extender, path []string, value *yaml.Node, operation Operation) error {
+	switch operation {
+	case DeleteOperation:
+		return extender.Delete(path)
+	case AppendOperation, MergeOperation:
+		current, err := getExtenderNode(extender, path)
+		if isPathNotFound(err) {
+			return extender.Set(path, value)
+		}
+		if err != nil {
+			return err
+		}
+		result, err := applyNodeOperation(current, yaml.NewRNode(value), operation)
+		if err != nil {
+			return err
+		}
+		return extender.Set(path, result.YNode())
+	}
+	return extender.Set(path, value)
+}
+
 // applyIndex applies value to input starting at the extended path index.
-func (ep *ExtendedPath) applyIndex(index int, input []byte, value *yaml.Node) ([]byte, error) {
+func (ep *ExtendedPath) applyIndex(index int, input []byte, value *yaml.Node, operation Operation) ([]byte, error) {
 	if index >= len(*ep.ExtendedSegments) || index < 0 {
 		return nil, fmt.Errorf("invalid extended path index: %d", index)
 	}
@@ -735,16 +1077,16 @@ func (ep *ExtendedPath) applyIndex(index int, input []byte, value *yaml.Node) ([
 	}
 
 	if index == len(*ep.ExtendedSegments)-1 {
-		err := extender.Set(segment.Path, value)
+		err := applyOperation(extender, segment.Path, value, operation)
 		if err != nil {
-			return nil, errors.WrapPrefixf(err, "setting value on path %s", segment.String())
+			return nil, errors.WrapPrefixf(err, "applying %s on path %s", operation, segment.String())
 		}
 	} else {
 		nextInput, err := extender.Get(segment.Path)
 		if err != nil {
 			return nil, errors.WrapPrefixf(err, "getting value on path %s", segment.String())
 		}
-		newValue, err := ep.applyIndex(index+1, nextInput, value)
+		newValue, err := ep.applyIndex(index+1, nextInput, value, operation)
 		if err != nil {
 			return nil, err
 		}
@@ -757,6 +1099,58 @@ func (ep *ExtendedPath) applyIndex(index int, input []byte, value *yaml.Node) ([
 	return extender.GetPayload()
 }
 
+// Get returns the value at the extended path in source. source is the KRM
+// resource specified by ResourcePrefix.
+//
+// Get creates the appropriate [Extender] for each extended segment and
+// traverses them until the last. If the last [Extender] is a [NodeExtender],
+// the returned value may be a structured node. Otherwise, it is a string
+// scalar. Get returns nil if the resource path doesn't exist in source.
+func (ep *ExtendedPath) Get(source *yaml.RNode) (*yaml.RNode, error) {
+	node, err := source.Pipe(yaml.Lookup(ep.ResourcePath...))
+	if err != nil || node == nil || !ep.HasExtensions() {
+		return node, err
+	}
+	var input []byte
+	if ep.isResourcePayload(node) {
+		if input, _, err = resourcePayload(node); err != nil {
+			return nil, err
+		}
+	} else if node.YNode().Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("extended path only works on scalar nodes")
+	} else {
+		input = []byte(node.YNode().Value)
+	}
+	for index, segment := range *ep.ExtendedSegments {
+		extender, err := segment.Extender(input)
+		if err != nil {
+			return nil, errors.WrapPrefixf(err, "creating extender at index: %d", index)
+		}
+		if nodeExtender, ok := extender.(NodeExtender); ok && index == len(*ep.ExtendedSegments)-1 {
+			result, err := nodeExtender.GetNode(segment.Path)
+			if err != nil {
+				return nil, ep.getError(err, segment)
+			}
+			return result, nil
+		}
+		input, err = extender.Get(segment.Path)
+		if err != nil {
+			return nil, ep.getError(err, segment)
+		}
+	}
+	return yaml.NewStringRNode(string(input)), nil
+}
+
+// getError wraps err, returned while getting the value of segment. A missing
+// path is reported as a [sourceNotFoundError] so that replacements can use
+// their default, fallback or optional settings.
+func (ep *ExtendedPath) getError(err error, segment *ExtendedSegment) error {
+	if isPathNotFound(err) {
+		return sourceNotFoundError(fmt.Sprintf("path %s not found in %s: %v", segment.String(), ep.String(), err))
+	}
+	return errors.WrapPrefixf(err, "getting value on path %s", segment.String())
+}
+
 // Apply applies value to target. target is the KRM resource specified by
 // ResourcePrefix.
 //
@@ -765,20 +1159,91 @@ func (ep *ExtendedPath) applyIndex(index int, input []byte, value *yaml.Node) ([
 // in the appropriate path. It then unwinds the paths and save the modified
 // value in the target.
 func (ep *ExtendedPath) Apply(target *yaml.RNode, value *yaml.RNode) error {
+	return ep.ApplyOperation(target, value, ReplaceOperation)
+}
+
+// ApplyOperation works like [ExtendedPath.Apply] but performs operation with
+// value at the last extended segment instead of replacing it. value is not
+// used by [DeleteOperation] and can be nil.
+func (ep *ExtendedPath) ApplyOperation(target *yaml.RNode, value *yaml.RNode, operation Operation) error {
+	if ep.HasExtensions() && ep.isResourcePayload(target) {
+		return ep.applyResource(target, value, operation)
+	}
 	if target.YNode().Kind != yaml.ScalarNode {
 		return fmt.Errorf("extended path only works on scalar nodes")
 	}
 
-	outValue := value.YNode().Value
-	if len(*ep.ExtendedSegments) > 0 {
-		input := []byte(target.YNode().Value)
-		output, err := ep.applyIndex(0, input, value.YNode())
+	if !ep.HasExtensions() {
+		if operation == DeleteOperation {
+			return fmt.Errorf("delete operation needs an extended segment")
+		}
+		result, err := applyNodeOperation(target, value, operation)
 		if err != nil {
-			return errors.WrapPrefixf(err, "applying value on extended segment %s", ep.String())
+			return err
 		}
+		target.YNode().Value = result.YNode().Value
+		return nil
+	}
+
+	var valueNode *yaml.Node
+	if value != nil {
+		valueNode = value.YNode()
+	}
+	output, err := ep.applyIndex(0, []byte(target.YNode().Value), valueNode, operation)
+	if err != nil {
+		return errors.WrapPrefixf(err, "applying value on extended segment %s", ep.String())
+	}
+	target.YNode().Value = string(output)
+	return nil
+}
 
-		outValue = string(output)
+// isResourcePayload returns true if the extended path starts at the root of
+// the resource node. In this case, the whole resource is the payload of the
+// first extended segment.
+func (ep *ExtendedPath) isResourcePayload(node *yaml.RNode) bool {
+	return len(ep.ResourcePath) == 0 && node.YNode().Kind == yaml.MappingNode
+}
+
+// resourcePayload returns the serialized resource r, without its internal
+// annotations, along with these annotations.
+func resourcePayload(r *yaml.RNode) ([]byte, map[string]string, error) {
+	content := r.Copy()
+	internal, err := removeInternalAnnotations(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := content.String()
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(payload), internal, nil
+}
+
+// applyResource works like [ExtendedPath.ApplyOperation] on the whole
+// resource target.
+func (ep *ExtendedPath) applyResource(target *yaml.RNode, value *yaml.RNode, operation Operation) error {
+	input, internal, err := resourcePayload(target)
+	if err != nil {
+		return err
+	}
+	var valueNode *yaml.Node
+	if value != nil {
+		valueNode = value.YNode()
+	}
+	output, err := ep.applyIndex(0, input, valueNode, operation)
+	if err != nil {
+		return errors.WrapPrefixf(err, "applying value on extended segment %s", ep.String())
+	}
+	if bytes.Equal(output, input) {
+		return nil
+	}
+	result, err := yaml.Parse(string(output))
+	if err != nil {
+		return errors.WrapPrefixf(err, "while parsing resource modified by %s", ep.String())
+	}
+	if err := restoreAnnotations(result, internal); err != nil {
+		return err
 	}
-	target.YNode().Value = outValue
+	target.SetYNode(result.YNode())
 	return nil
 }
@@ -0,0 +1,200 @@
+package extras
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/errors"
+)
+
+///////
+// Gzip
+///////
+
+// gzipExtender manages gzip compressed content in KRM resources.
+type gzipExtender struct {
+	header     gzip.Header // The header of the source payload
+	compressed []byte      // The source payload
+	decoded    []byte      // The decompressed payload
+}
+
+// SetPayload decompresses the payload and stores it in internal state.
+//
+// Payloads made of several concatenated gzip members are rejected as they
+// cannot be compressed back with a single header.
+func (e *gzipExtender) SetPayload(payload []byte) error {
+	input := bytes.NewReader(payload)
+	reader, err := gzip.NewReader(input)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while reading gzip header")
+	}
+	defer reader.Close()
+	// Only read the first member of the stream
+	reader.Multistream(false)
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while decompressing gzip")
+	}
+	if input.Len() > 0 {
+		return fmt.Errorf("gzip payloads with several members are not supported")
+	}
+	e.header = reader.Header
+	e.compressed = payload
+	e.decoded = decoded
+	return nil
+}
+
+// GetPayload returns the current payload compressed with gzip.
+//
+// The header of the source payload is reused and the compression level is
+// always the default one, so that compressing the same content gives the same
+// result. If the content has not been modified, the source payload is returned
+// as is.
+func (e *gzipExtender) GetPayload() ([]byte, error) {
+	if e.compressed != nil {
+		return e.compressed, nil
+	}
+	var b bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&b, gzip.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	writer.Header = e.header
+	if _, err := writer.Write(e.decoded); err != nil {
+		return nil, errors.WrapPrefixf(err, "while compressing gzip")
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.WrapPrefixf(err, "while compressing gzip")
+	}
+	return b.Bytes(), nil
+}
+
+// Get returns the current decompressed payload.
+//
+// An error is returned if the path is not empty.
+func (e *gzipExtender) Get(path []string) ([]byte, error) {
+	if len(path) > 0 {
+		return nil, fmt.Errorf("path is invalid for gzip: %s", strings.Join(path, "."))
+	}
+	return e.decoded, nil
+}
+
+// Set stores value in the current payload. path must be empty.
+func (e *gzipExtender) Set(path []string, value any) error {
+	if len(path) > 0 {
+		return fmt.Errorf("path is invalid for gzip: %s", strings.Join(path, "."))
+	}
+	decoded := getByteValue(value)
+	if !bytes.Equal(decoded, e.decoded) {
+		e.decoded = decoded
+		e.compressed = nil
+	}
+	return nil
+}
+
+// Delete empties the current payload. path must be empty.
+func (e *gzipExtender) Delete(path []string) error {
+	return e.Set(path, []byte{})
+}
+
+// NewGzipExtender returns a newly created gzip extender.
+//
+// As the [NewBase64Extender] one, this extender doesn't allow structured
+// traversal and modification. It passes its decompressed payload downstream.
+// As gzip content is binary, it is usually found inside base64:
+//
+//	data.release.!!base64.!!base64.!!gzip.!!json.chart.metadata.version
+//
+// The modified content is compressed with the default compression level and
+// the header of the source content (name, modification time), so that
+// repeated runs produce identical output.
+func NewGzipExtender() Extender {
+	return &gzipExtender{}
+}
+
+///////
+// Zlib
+///////
+
+// zlibExtender manages zlib compressed content in KRM resources.
+type zlibExtender struct {
+	compressed []byte // The source payload
+	decoded    []byte // The decompressed payload
+}
+
+// SetPayload decompresses the payload and stores it in internal state.
+func (e *zlibExtender) SetPayload(payload []byte) error {
+	reader, err := zlib.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return errors.WrapPrefixf(err, "while reading zlib header")
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while decompressing zlib")
+	}
+	e.compressed = payload
+	e.decoded = decoded
+	return nil
+}
+
+// GetPayload returns the current payload compressed with zlib.
+//
+// The compression level is always the default one. If the content has not
+// been modified, the source payload is returned as is.
+func (e *zlibExtender) GetPayload() ([]byte, error) {
+	if e.compressed != nil {
+		return e.compressed, nil
+	}
+	var b bytes.Buffer
+	writer, err := zlib.NewWriterLevel(&b, zlib.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(e.decoded); err != nil {
+		return nil, errors.WrapPrefixf(err, "while compressing zlib")
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.WrapPrefixf(err, "while compressing zlib")
+	}
+	return b.Bytes(), nil
+}
+
+// Get returns the current decompressed payload.
+//
+// An error is returned if the path is not empty.
+func (e *zlibExtender) Get(path []string) ([]byte, error) {
+	if len(path) > 0 {
+		return nil, fmt.Errorf("path is invalid for zlib: %s", strings.Join(path, "."))
+	}
+	return e.decoded, nil
+}
+
+// Set stores value in the current payload. path must be empty.
+func (e *zlibExtender) Set(path []string, value any) error {
+	if len(path) > 0 {
+		return fmt.Errorf("path is invalid for zlib: %s", strings.Join(path, "."))
+	}
+	decoded := getByteValue(value)
+	if !bytes.Equal(decoded, e.decoded) {
+		e.decoded = decoded
+		e.compressed = nil
+	}
+	return nil
+}
+
+// Delete empties the current payload. path must be empty.
+func (e *zlibExtender) Delete(path []string) error {
+	return e.Set(path, []byte{})
+}
+
+// NewZlibExtender returns a newly created zlib extender.
+//
+// It works like the [NewGzipExtender] one for content compressed with zlib.
+func NewZlibExtender() Extender {
+	return &zlibExtender{}
+}
@@ -0,0 +1,369 @@
+package extras
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+//////
+// HCL
+//////
+
+// hclExtender allows structured modification of HCL content (Terraform,
+// Nomad, Packer...).
+//
+// Internally, it uses the hclwrite package that preserves the formatting and
+// the comments of the parts of the content that are not modified.
+type hclExtender struct {
+	file *hclwrite.File
+}
+
+// hclTarget is the element of the HCL content addressed by a path.
+type hclTarget struct {
+	body  *hclwrite.Body  // body containing the target
+	block *hclwrite.Block // block addressed, if any
+	name  string          // attribute name if the target is an attribute
+	path  []string        // remaining path inside the attribute value
+}
+
+// SetPayload parses payload as HCL and set the internal state.
+func (e *hclExtender) SetPayload(payload []byte) error {
+	file, diags := hclwrite.ParseConfig(payload, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return errors.WrapPrefixf(diags, "while parsing hcl")
+	}
+	e.file = file
+	return nil
+}
+
+// GetPayload returns the current state as HCL.
+func (e *hclExtender) GetPayload() ([]byte, error) {
+	return e.file.Bytes(), nil
+}
+
+// lookupHcl returns the target addressed by path in body.
+//
+// A path segment matching a block type must be followed by the block labels.
+// The first segment that doesn't match a block is considered an attribute
+// name. The remaining segments address a part of the attribute value.
+func lookupHcl(body *hclwrite.Body, path []string) (*hclTarget, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	if body.GetAttribute(path[0]) == nil {
+		for _, block := range body.Blocks() {
+			labels := block.Labels()
+			if block.Type() != path[0] || len(path) < len(labels)+1 || !samePath(labels, path[1:len(labels)+1]) {
+				continue
+			}
+			rest := path[len(labels)+1:]
+			if len(rest) == 0 {
+				return &hclTarget{body: body, block: block}, nil
+			}
+			return lookupHcl(block.Body(), rest)
+		}
+	}
+	return &hclTarget{body: body, name: path[0], path: path[1:]}, nil
+}
+
+// hclAttributeValue evaluates the value of attribute. It fails if the
+// attribute value is not a literal (i.e. contains references or function
+// calls).
+func hclAttributeValue(attribute *hclwrite.Attribute) (cty.Value, error) {
+	src := attribute.Expr().BuildTokens(nil).Bytes()
+	expr, diags := hclsyntax.ParseExpression(src, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return value, nil
+}
+
+// hclScalarString returns the string representation of a primitive value.
+func hclScalarString(value cty.Value) (string, bool) {
+	if value.IsNull() || !value.IsKnown() {
+		return "", false
+	}
+	switch value.Type() {
+	case cty.String:
+		return value.AsString(), true
+	case cty.Number:
+		return value.AsBigFloat().Text('f', -1), true
+	case cty.Bool:
+		return strconv.FormatBool(value.True()), true
+	}
+	return "", false
+}
+
+// hclValueToNode converts value into a YAML node.
+func hclValueToNode(value cty.Value) (*yaml.RNode, error) {
+	b, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Parse(string(b))
+}
+
+// hclValueFromNode converts the YAML node into a cty value.
+func hclValueFromNode(node *yaml.Node) (cty.Value, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case yaml.NodeTagInt, yaml.NodeTagFloat:
+			return cty.ParseNumberVal(node.Value)
+		case yaml.NodeTagBool:
+			b, err := strconv.ParseBool(node.Value)
+			if err == nil {
+				return cty.BoolVal(b), nil
+			}
+		case yaml.NodeTagNull:
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		}
+		return cty.StringVal(node.Value), nil
+	case yaml.SequenceNode:
+		items := []cty.Value{}
+		for _, item := range node.Content {
+			v, err := hclValueFromNode(item)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			items = append(items, v)
+		}
+		if len(items) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		return cty.TupleVal(items), nil
+	case yaml.MappingNode:
+		attributes := map[string]cty.Value{}
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			v, err := hclValueFromNode(node.Content[i+1])
+			if err != nil {
+				return cty.NilVal, err
+			}
+			attributes[node.Content[i].Value] = v
+		}
+		if len(attributes) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		return cty.ObjectVal(attributes), nil
+	case yaml.AliasNode:
+		return hclValueFromNode(node.Alias)
+	}
+	return cty.NilVal, fmt.Errorf("unsupported node kind %d", node.Kind)
+}
+
+// hclValue converts value into a cty value. If original is not null, the type
+// of original is preserved when possible.
+func hclValue(value any, original cty.Value) (cty.Value, error) {
+	if node, ok := value.(*yaml.Node); ok && (node.Kind != yaml.ScalarNode || original == cty.NilVal) {
+		return hclValueFromNode(node)
+	}
+	s := string(getByteValue(value))
+	if original != cty.NilVal && !original.IsNull() {
+		switch original.Type() {
+		case cty.Number:
+			if v, err := cty.ParseNumberVal(s); err == nil {
+				return v, nil
+			}
+		case cty.Bool:
+			if b, err := strconv.ParseBool(s); err == nil {
+				return cty.BoolVal(b), nil
+			}
+		}
+	}
+	return cty.StringVal(s), nil
+}
+
+// Get returns the value of the attribute addressed by path. String values
+// are returned unquoted. If the attribute value is not a literal, its source
+// is returned. If path addresses a block, the block body is returned.
+func (e *hclExtender) Get(path []string) ([]byte, error) {
+	target, err := lookupHcl(e.file.Body(), path)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	if target.block != nil {
+		return target.block.Body().BuildTokens(nil).Bytes(), nil
+	}
+	attribute := target.body.GetAttribute(target.name)
+	if attribute == nil {
+		return nil, pathNotFoundError(fmt.Sprintf("attribute %s not found at path %s", target.name, strings.Join(path, ".")))
+	}
+	value, err := hclAttributeValue(attribute)
+	if err != nil {
+		if len(target.path) > 0 {
+			return nil, errors.WrapPrefixf(err, "while evaluating attribute %s", target.name)
+		}
+		return []byte(strings.TrimSpace(string(attribute.Expr().BuildTokens(nil).Bytes()))), nil
+	}
+	if len(target.path) == 0 {
+		if s, ok := hclScalarString(value); ok {
+			return []byte(s), nil
+		}
+	}
+	node, err := hclValueToNode(value)
+	if err != nil {
+		return nil, err
+	}
+	return getNodePath(node, target.path, serializeNode)
+}
+
+// GetNode returns the value of the attribute addressed by path as a node. If
+// the attribute value is not a literal or if path addresses a block, the
+// source is returned as a string.
+func (e *hclExtender) GetNode(path []string) (*yaml.RNode, error) {
+	target, err := lookupHcl(e.file.Body(), path)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	if target.block == nil {
+		if attribute := target.body.GetAttribute(target.name); attribute != nil {
+			if value, err := hclAttributeValue(attribute); err == nil {
+				node, err := hclValueToNode(value)
+				if err != nil {
+					return nil, err
+				}
+				return lookupNode(node, target.path)
+			}
+		}
+	}
+	value, err := e.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.NewStringRNode(string(value)), nil
+}
+
+// setBlock sets the attributes of block from the mapping node. Mapping keys
+// corresponding to a nested block are applied recursively to the block.
+func setBlock(block *hclwrite.Block, node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("block %s can only be set with a mapping", block.Type())
+	}
+	body := block.Body()
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		name, value := node.Content[i].Value, node.Content[i+1]
+		if body.GetAttribute(name) == nil && value.Kind == yaml.MappingNode {
+			if nested := body.FirstMatchingBlock(name, nil); nested != nil {
+				if err := setBlock(nested, value); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := setHclAttribute(&hclTarget{body: body, name: name}, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setHclAttribute sets the value of the attribute addressed by target.
+func setHclAttribute(target *hclTarget, value any) error {
+	attribute := target.body.GetAttribute(target.name)
+	original := cty.NilVal
+	if attribute != nil {
+		if v, err := hclAttributeValue(attribute); err == nil {
+			original = v
+		} else if len(target.path) > 0 {
+			return errors.WrapPrefixf(err, "while evaluating attribute %s", target.name)
+		}
+	} else if len(target.path) > 0 {
+		return fmt.Errorf("attribute %s not found", target.name)
+	}
+
+	if len(target.path) > 0 {
+		node, err := hclValueToNode(original)
+		if err != nil {
+			return err
+		}
+		if isNullValue(value) {
+			if err := deleteNodePath(node, target.path); err != nil {
+				return err
+			}
+		} else if err := setValue(node, target.path, value); err != nil {
+			return err
+		}
+		v, err := hclValueFromNode(node.YNode())
+		if err != nil {
+			return err
+		}
+		target.body.SetAttributeValue(target.name, v)
+		return nil
+	}
+
+	if isNullValue(value) {
+		target.body.RemoveAttribute(target.name)
+		return nil
+	}
+	v, err := hclValue(value, original)
+	if err != nil {
+		return err
+	}
+	target.body.SetAttributeValue(target.name, v)
+	return nil
+}
+
+// Set sets the attribute addressed by path with value.
+//
+// If path addresses a block, value must be a mapping and its keys are set as
+// attributes of the block. A null value removes the addressed attribute or
+// block.
+func (e *hclExtender) Set(path []string, value any) error {
+	target, err := lookupHcl(e.file.Body(), path)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while setting path %s", strings.Join(path, "."))
+	}
+	if target.block != nil {
+		if isNullValue(value) {
+			target.body.RemoveBlock(target.block)
+			return nil
+		}
+		node, ok := value.(*yaml.Node)
+		if !ok {
+			return fmt.Errorf("block at path %s can only be set with a mapping", strings.Join(path, "."))
+		}
+		return setBlock(target.block, node)
+	}
+	if err := setHclAttribute(target, value); err != nil {
+		return errors.WrapPrefixf(err, "while setting path %s", strings.Join(path, "."))
+	}
+	return nil
+}
+
+// Delete removes the attribute or the block addressed by path.
+func (e *hclExtender) Delete(path []string) error {
+	return e.Set(path, yaml.MakeNullNode().YNode())
+}
+
+// NewHclExtender returns a newly created [Extender] for modifying HCL content
+// like Terraform or Nomad configurations.
+//
+// Blocks are addressed by their type followed by their labels. For instance,
+// the path resource.aws_s3_bucket.logs.bucket addresses the bucket attribute
+// of the following block:
+//
+//	resource "aws_s3_bucket" "logs" {
+//	  bucket = "my-logs"
+//	}
+//
+// Segments after the attribute name address a part of the attribute value,
+// provided it is a literal. When path addresses a block, the source must be a
+// mapping whose keys are set as attributes. A null source removes the
+// addressed attribute or block. Formatting and comments of the unmodified
+// parts are preserved.
+func NewHclExtender() Extender {
+	return &hclExtender{}
+}
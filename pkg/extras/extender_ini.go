@@ -0,0 +1,369 @@
+package extras
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-ini/ini"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+//////
+// INI
+//////
+
+// iniExtender allows structured modification of ini file based properties.
+type iniExtender struct {
+	file *ini.File
+}
+
+// iniTarget is the element of the ini file addressed by a path.
+type iniTarget struct {
+	section string
+	key     string // empty when the whole section is addressed
+	index   int    // index of the shadowed value, -1 for the key itself
+}
+
+// SetPayload parses payload as a INI file and set the internal state.
+//
+// Repeated keys are kept as shadows of the first one.
+func (e *iniExtender) SetPayload(payload []byte) (err error) {
+
+	e.file, err = ini.LoadSources(ini.LoadOptions{
+		AllowShadows:               true,
+		AllowDuplicateShadowValues: true,
+	}, payload)
+	return err
+}
+
+// GetPayload returns the current state as an ini file.
+func (e *iniExtender) GetPayload() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := e.file.WriteTo(&b)
+	return b.Bytes(), err
+}
+
+// isNullValue returns true if value is a YAML null node.
+func isNullValue(value any) bool {
+	node, ok := value.(*yaml.Node)
+	return ok && (node.Tag == yaml.NodeTagNull || (node.Kind == yaml.ScalarNode && node.ShortTag() == yaml.NodeTagNull))
+}
+
+// targetFromPath returns the section, key and shadow index addressed by path.
+//
+// A single segment addresses a key of the default section if it exists, a
+// section otherwise. A segment between brackets always addresses a section.
+// With two segments, the first one is the section and the second one the
+// key. A third numeric segment addresses a shadowed value of the key.
+func (e *iniExtender) targetFromPath(path []string) (*iniTarget, error) {
+	if len(path) < 1 || len(path) > 3 {
+		return nil, fmt.Errorf("invalid path length: %d", len(path))
+	}
+	target := &iniTarget{section: path[0], index: -1}
+	if strings.HasPrefix(target.section, "[") && strings.HasSuffix(target.section, "]") {
+		target.section = target.section[1 : len(target.section)-1]
+	} else if len(path) == 1 {
+		if e.file.Section(ini.DefaultSection).HasKey(path[0]) || !e.file.HasSection(path[0]) {
+			target.section = ini.DefaultSection
+			target.key = path[0]
+		}
+		return target, nil
+	}
+	if len(path) > 1 {
+		target.key = path[1]
+	}
+	if len(path) == 3 {
+		index, err := strconv.Atoi(path[2])
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid value index: %s", path[2])
+		}
+		target.index = index
+	}
+	return target, nil
+}
+
+// setKeyValues sets the values of the key name in section. If there is more
+// than one value, the additional values are added as shadows. If values is
+// empty, the key is removed.
+//
+// As shadows cannot be removed individually, the keys of the section are
+// recreated in their original order.
+func setKeyValues(section *ini.Section, name string, values []string) error {
+	if len(values) == 1 && section.HasKey(name) && len(section.Key(name).ValueWithShadows()) == 1 {
+		section.Key(name).SetValue(values[0])
+		return nil
+	}
+
+	type savedKey struct {
+		name    string
+		comment string
+		values  []string
+	}
+	saved := []savedKey{}
+	found := false
+	for _, k := range section.Keys() {
+		key := savedKey{name: k.Name(), comment: k.Comment, values: k.ValueWithShadows()}
+		if key.name == name {
+			key.values = values
+			found = true
+		}
+		saved = append(saved, key)
+		section.DeleteKey(key.name)
+	}
+	if !found {
+		saved = append(saved, savedKey{name: name, values: values})
+	}
+
+	for _, key := range saved {
+		if len(key.values) == 0 {
+			continue
+		}
+		k, err := section.NewKey(key.name, key.values[0])
+		if err != nil {
+			return err
+		}
+		k.Comment = key.comment
+		for _, v := range key.values[1:] {
+			if err := k.AddShadow(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the content of the key specified by path. If path addresses a
+// section, the keys of the section are returned in ini format.
+func (e *iniExtender) Get(path []string) ([]byte, error) {
+	target, err := e.targetFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("while getting key at path %s", strings.Join(path, "."))
+	}
+	if !e.file.HasSection(target.section) {
+		return nil, pathNotFoundError(fmt.Sprintf("section %s not found", target.section))
+	}
+	section := e.file.Section(target.section)
+
+	if target.key == "" {
+		content := ini.Empty(ini.LoadOptions{AllowShadows: true, AllowDuplicateShadowValues: true})
+		for _, k := range section.Keys() {
+			if err := setKeyValues(content.Section(ini.DefaultSection), k.Name(), k.ValueWithShadows()); err != nil {
+				return nil, err
+			}
+		}
+		var b bytes.Buffer
+		_, err := content.WriteTo(&b)
+		return b.Bytes(), err
+	}
+
+	if !section.HasKey(target.key) {
+		return nil, pathNotFoundError(fmt.Sprintf("key %s not found in section %s", target.key, target.section))
+	}
+	k := section.Key(target.key)
+	if target.index < 0 {
+		return []byte(k.String()), nil
+	}
+	values := k.ValueWithShadows()
+	if target.index >= len(values) {
+		return nil, pathNotFoundError(fmt.Sprintf("index %d out of range for key %s", target.index, target.key))
+	}
+	return []byte(values[target.index]), nil
+}
+
+// valuesNode returns values as a scalar node if there is only one value, or
+// as a sequence node otherwise.
+func valuesNode(values []string) *yaml.RNode {
+	if len(values) == 1 {
+		return yaml.NewStringRNode(values[0])
+	}
+	return yaml.NewListRNode(values...)
+}
+
+// GetNode returns the content of the key specified by path as a node. Keys
+// with shadowed values are returned as sequences. If path addresses a
+// section, a mapping of its keys is returned.
+func (e *iniExtender) GetNode(path []string) (*yaml.RNode, error) {
+	target, err := e.targetFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("while getting key at path %s", strings.Join(path, "."))
+	}
+	if !e.file.HasSection(target.section) {
+		return nil, pathNotFoundError(fmt.Sprintf("section %s not found", target.section))
+	}
+	section := e.file.Section(target.section)
+
+	if target.key == "" {
+		result := yaml.NewMapRNode(nil)
+		for _, k := range section.Keys() {
+			if err := result.PipeE(yaml.SetField(k.Name(), valuesNode(k.ValueWithShadows()))); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	if !section.HasKey(target.key) {
+		return nil, pathNotFoundError(fmt.Sprintf("key %s not found in section %s", target.key, target.section))
+	}
+	values := section.Key(target.key).ValueWithShadows()
+	if target.index < 0 {
+		return valuesNode(values), nil
+	}
+	if target.index >= len(values) {
+		return nil, pathNotFoundError(fmt.Sprintf("index %d out of range for key %s", target.index, target.key))
+	}
+	return yaml.NewStringRNode(values[target.index]), nil
+}
+
+// setSection replaces the keys of section with the ones of the mapping node.
+// Existing keys keep their position and comments. New keys get the comment of
+// the mapping key, if any.
+func setSection(section *ini.Section, node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("a section can only be set with a mapping")
+	}
+	names := map[string]bool{}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		names[node.Content[i].Value] = true
+	}
+	for _, name := range section.KeyStrings() {
+		if !names[name] {
+			section.DeleteKey(name)
+		}
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		value := node.Content[i+1]
+		values := []string{}
+		if value.Kind == yaml.SequenceNode {
+			for _, item := range value.Content {
+				values = append(values, item.Value)
+			}
+		} else {
+			values = append(values, value.Value)
+		}
+		name := node.Content[i].Value
+		if err := setKeyValues(section, name, values); err != nil {
+			return err
+		}
+		if comment := node.Content[i].HeadComment; comment != "" && section.Key(name).Comment == "" {
+			section.Key(name).Comment = comment
+		}
+	}
+	return nil
+}
+
+// Set sets the value of the key specified by path with value.
+//
+// If path addresses a section, value must be a mapping and the section keys
+// are replaced by the mapping ones. A value set on a key without index
+// replaces all its shadowed values: a sequence gives one value per element and
+// a scalar a single value. A null value removes the addressed key, value or
+// section.
+func (e *iniExtender) Set(path []string, value any) error {
+	target, err := e.targetFromPath(path)
+	if err != nil {
+		return fmt.Errorf("while getting key at path %s", strings.Join(path, "."))
+	}
+	if isNullValue(value) {
+		return e.delete(target)
+	}
+
+	if node, ok := value.(*yaml.Node); ok && node.Kind == yaml.MappingNode && len(path) == 1 {
+		target = &iniTarget{section: target.section, index: -1}
+		if target.section == ini.DefaultSection {
+			target.section = path[0]
+		}
+	}
+
+	section := e.file.Section(target.section)
+
+	if target.key == "" {
+		node, ok := value.(*yaml.Node)
+		if !ok {
+			return fmt.Errorf("section %s can only be set with a mapping", target.section)
+		}
+		return setSection(section, node)
+	}
+
+	if node, ok := value.(*yaml.Node); ok && node.Kind == yaml.SequenceNode && target.index < 0 {
+		values := []string{}
+		for _, item := range node.Content {
+			values = append(values, item.Value)
+		}
+		return setKeyValues(section, target.key, values)
+	}
+
+	v := string(getByteValue(value))
+	if target.index < 0 {
+		return setKeyValues(section, target.key, []string{v})
+	}
+
+	values := []string{}
+	if section.HasKey(target.key) {
+		values = section.Key(target.key).ValueWithShadows()
+	}
+	switch {
+	case target.index < len(values):
+		values[target.index] = v
+	case target.index == len(values):
+		values = append(values, v)
+	default:
+		return fmt.Errorf("index %d out of range for key %s", target.index, target.key)
+	}
+	return setKeyValues(section, target.key, values)
+}
+
+// Delete removes the section, key or shadowed value addressed by path.
+func (e *iniExtender) Delete(path []string) error {
+	target, err := e.targetFromPath(path)
+	if err != nil {
+		return fmt.Errorf("while getting key at path %s", strings.Join(path, "."))
+	}
+	return e.delete(target)
+}
+
+// delete removes the section, key or shadowed value addressed by target.
+func (e *iniExtender) delete(target *iniTarget) error {
+	if !e.file.HasSection(target.section) {
+		return nil
+	}
+	if target.key == "" {
+		e.file.DeleteSection(target.section)
+		return nil
+	}
+	section := e.file.Section(target.section)
+	if !section.HasKey(target.key) {
+		return nil
+	}
+	values := []string{}
+	if target.index >= 0 {
+		values = section.Key(target.key).ValueWithShadows()
+		if target.index >= len(values) {
+			return nil
+		}
+		values = append(values[:target.index], values[target.index+1:]...)
+	}
+	return setKeyValues(section, target.key, values)
+}
+
+// NewIniExtender returns a newly created [Extender] for modifying INI files
+// like properties.
+//
+// Some tools may use ini type configuration files. This extender allows
+// modification of the values. If paths have one element, it will set the
+// corresponding property at the root level, or the section with this name if
+// there is no such property. A path element between brackets ([name]) always
+// designates a section. If path have two elements, the first one contains the
+// section name and the second the property name. A third numeric element
+// designates one of the values of a repeated key.
+//
+// A whole section can be set from a mapping, and a null value removes the
+// addressed key or section.
+//
+// Please be aware that this [Extender] preserves the ordering and the comments
+// of the content but not the blank lines nor the spacing.
+func NewIniExtender() Extender {
+	return &iniExtender{}
+}
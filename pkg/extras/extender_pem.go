@@ -0,0 +1,291 @@
+package extras
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // used for fingerprints only
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+//////
+// PEM
+//////
+
+// pemBlock is one of the blocks of a PEM bundle.
+type pemBlock struct {
+	prefix string // text preceding the block
+	raw    string // source text of the block
+	block  *pem.Block
+}
+
+// pemExtender allows reading the attributes of the certificates contained in
+// a PEM bundle and replacing whole blocks.
+type pemExtender struct {
+	blocks []*pemBlock
+	suffix string // text following the last block
+}
+
+// parsePemBlocks splits payload into PEM blocks. It returns the blocks and the
+// text following the last one.
+func parsePemBlocks(payload []byte) ([]*pemBlock, string) {
+	blocks := []*pemBlock{}
+	rest := payload
+	for {
+		block, next := pem.Decode(rest)
+		if block == nil {
+			return blocks, string(rest)
+		}
+		consumed := rest[:len(rest)-len(next)]
+		begin := bytes.Index(consumed, []byte("-----BEGIN"))
+		blocks = append(blocks, &pemBlock{
+			prefix: string(consumed[:begin]),
+			raw:    string(consumed[begin:]),
+			block:  block,
+		})
+		rest = next
+	}
+}
+
+// SetPayload parses payload as a PEM bundle and sets the internal state.
+func (e *pemExtender) SetPayload(payload []byte) error {
+	e.blocks, e.suffix = parsePemBlocks(payload)
+	if len(e.blocks) == 0 && strings.TrimSpace(e.suffix) != "" {
+		return fmt.Errorf("no PEM block found in payload")
+	}
+	return nil
+}
+
+// GetPayload returns the current PEM bundle.
+func (e *pemExtender) GetPayload() ([]byte, error) {
+	var b strings.Builder
+	for _, block := range e.blocks {
+		b.WriteString(block.prefix)
+		b.WriteString(block.raw)
+	}
+	b.WriteString(e.suffix)
+	return []byte(b.String()), nil
+}
+
+// pemName returns the attributes of a certificate subject or issuer.
+func pemName(name pkix.Name) map[string]interface{} {
+	return map[string]interface{}{
+		"cn": name.CommonName,
+		"dn": name.String(),
+		"o":  name.Organization,
+		"ou": name.OrganizationalUnit,
+	}
+}
+
+// attributes returns the attributes of the block as a RNode. All blocks have
+// a type, der and pem attribute. Certificates have additional attributes.
+func (b *pemBlock) attributes() (*yaml.RNode, error) {
+	m := map[string]interface{}{
+		"type": b.block.Type,
+		"der":  base64.StdEncoding.EncodeToString(b.block.Bytes),
+		"pem":  b.raw,
+	}
+	if b.block.Type == "CERTIFICATE" {
+		certificate, err := x509.ParseCertificate(b.block.Bytes)
+		if err != nil {
+			return nil, errors.WrapPrefixf(err, "while parsing certificate")
+		}
+		sha256Sum := sha256.Sum256(certificate.Raw)
+		sha1Sum := sha1.Sum(certificate.Raw) //nolint:gosec // used for fingerprints only
+		ips := []string{}
+		for _, ip := range certificate.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+		uris := []string{}
+		for _, uri := range certificate.URIs {
+			uris = append(uris, uri.String())
+		}
+		sans := append([]string{}, certificate.DNSNames...)
+		sans = append(sans, ips...)
+		sans = append(sans, certificate.EmailAddresses...)
+		sans = append(sans, uris...)
+
+		m["subject"] = pemName(certificate.Subject)
+		m["issuer"] = pemName(certificate.Issuer)
+		m["serial"] = certificate.SerialNumber.String()
+		m["notBefore"] = certificate.NotBefore.UTC().Format(time.RFC3339)
+		m["notAfter"] = certificate.NotAfter.UTC().Format(time.RFC3339)
+		m["isCA"] = certificate.IsCA
+		m["sans"] = sans
+		m["dnsNames"] = certificate.DNSNames
+		m["ipAddresses"] = ips
+		m["emailAddresses"] = certificate.EmailAddresses
+		m["uris"] = uris
+		m["fingerprint"] = hex.EncodeToString(sha256Sum[:])
+		m["sha1Fingerprint"] = hex.EncodeToString(sha1Sum[:])
+	}
+	return yaml.FromMap(m)
+}
+
+// selectBlock returns the index of the block addressed by the first segment of
+// path and the remaining path.
+//
+// The first segment can be the index of the block or a [key=value] selector
+// on its attributes. Otherwise, the first block is used.
+func (e *pemExtender) selectBlock(path []string) (int, []string, error) {
+	if len(path) == 0 {
+		return 0, path, nil
+	}
+	segment := path[0]
+	if index, err := strconv.Atoi(segment); err == nil {
+		if index < 0 || index > len(e.blocks) {
+			return 0, nil, pathNotFoundError(fmt.Sprintf("block index %d out of range", index))
+		}
+		return index, path[1:], nil
+	}
+	if yaml.IsListIndex(segment) {
+		key, value, err := yaml.SplitIndexNameValue(segment)
+		if err != nil {
+			return 0, nil, err
+		}
+		for index, block := range e.blocks {
+			attributes, err := block.attributes()
+			if err != nil {
+				return 0, nil, err
+			}
+			field, err := attributes.Pipe(yaml.Lookup(strings.Split(key, ".")...))
+			if err == nil && field != nil && yaml.GetValue(field) == value {
+				return index, path[1:], nil
+			}
+		}
+		return 0, nil, pathNotFoundError(fmt.Sprintf("no block matching %s", segment))
+	}
+	return 0, path, nil
+}
+
+// Get returns the attribute of the block addressed by path. If the path only
+// contains the block selector, the PEM text of the block is returned. An empty
+// path returns the whole bundle.
+func (e *pemExtender) Get(path []string) ([]byte, error) {
+	if len(path) == 0 {
+		return e.GetPayload()
+	}
+	index, rest, err := e.selectBlock(path)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	if index >= len(e.blocks) {
+		return nil, pathNotFoundError(fmt.Sprintf("block index %d out of range", index))
+	}
+	block := e.blocks[index]
+	if len(rest) == 0 {
+		return []byte(block.raw), nil
+	}
+	attributes, err := block.attributes()
+	if err != nil {
+		return nil, err
+	}
+	return getNodePath(attributes, rest, serializeNode)
+}
+
+// GetNode returns the attribute of the block addressed by path as a node.
+func (e *pemExtender) GetNode(path []string) (*yaml.RNode, error) {
+	index, rest, err := e.selectBlock(path)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	if len(rest) == 0 || index >= len(e.blocks) {
+		value, err := e.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		return yaml.NewStringRNode(string(value)), nil
+	}
+	attributes, err := e.blocks[index].attributes()
+	if err != nil {
+		return nil, err
+	}
+	return lookupNode(attributes, rest)
+}
+
+// Set replaces the block addressed by path with value, that must be PEM
+// encoded. The attributes of the blocks cannot be set. A null value removes
+// the block, and the index following the last block appends a new one. An
+// empty path replaces the whole bundle.
+func (e *pemExtender) Set(path []string, value any) error {
+	if len(path) == 0 {
+		return e.SetPayload(getByteValue(value))
+	}
+	index, rest, err := e.selectBlock(path)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while setting path %s", strings.Join(path, "."))
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("pem attributes are read only: %s", strings.Join(path, "."))
+	}
+
+	if isNullValue(value) {
+		if index < len(e.blocks) {
+			e.blocks = append(e.blocks[:index], e.blocks[index+1:]...)
+		}
+		return nil
+	}
+
+	blocks, suffix := parsePemBlocks(getByteValue(value))
+	if len(blocks) != 1 || strings.TrimSpace(blocks[0].prefix+suffix) != "" {
+		return fmt.Errorf("value for path %s should contain one PEM block", strings.Join(path, "."))
+	}
+	block := blocks[0]
+	if !strings.HasSuffix(block.raw, "\n") {
+		block.raw += "\n"
+	}
+
+	if index == len(e.blocks) {
+		if index > 0 && !strings.HasSuffix(e.blocks[index-1].raw, "\n") {
+			e.blocks[index-1].raw += "\n"
+		}
+		e.blocks = append(e.blocks, block)
+		return nil
+	}
+	block.prefix = e.blocks[index].prefix
+	e.blocks[index] = block
+	return nil
+}
+
+// Delete removes the block addressed by path. An empty path removes all the
+// blocks.
+func (e *pemExtender) Delete(path []string) error {
+	if len(path) == 0 {
+		e.blocks, e.suffix = []*pemBlock{}, ""
+		return nil
+	}
+	return e.Set(path, yaml.MakeNullNode().YNode())
+}
+
+// NewPemExtender returns a newly created [Extender] for reading PEM bundles.
+//
+// The first path segment selects the block by index or with a [key=value]
+// selector on its attributes. Without selector, the first block is used. The
+// remaining segments address the block attributes:
+//
+//	type, der (base64), pem
+//
+// And for certificates:
+//
+//	subject.cn, subject.dn, subject.o, subject.ou (same for issuer), serial,
+//	notBefore, notAfter, isCA, sans, dnsNames, ipAddresses, emailAddresses,
+//	uris, fingerprint (SHA-256), sha1Fingerprint
+//
+// For instance:
+//
+//	data.ca\.crt.!!pem.[subject.cn=root-ca].notAfter
+//
+// Modifications can only replace, add or remove whole blocks.
+func NewPemExtender() Extender {
+	return &pemExtender{}
+}
@@ -0,0 +1,610 @@
+package extras
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+/////////////////////
+// Properties / Env
+/////////////////////
+
+// keyValueEntry is a key/value entry found in a properties or dotenv file.
+//
+// start and end are the offsets of the raw value in the payload. The raw value
+// contains quotes and escape sequences. lineStart and lineEnd are the offsets
+// of the lines containing the entry, line break included.
+type keyValueEntry struct {
+	key       string
+	start     int
+	end       int
+	lineStart int
+	lineEnd   int
+}
+
+// keyValueFormat parses and encodes the entries of a line based key/value
+// file format.
+type keyValueFormat interface {
+	// entries returns the key/value entries found in text.
+	entries(text []byte) ([]keyValueEntry, error)
+	// decode returns the value corresponding to the raw value.
+	decode(raw string) (string, error)
+	// encode returns the raw value for value. original is the raw value that
+	// is replaced. It is empty when adding a new key.
+	encode(value string, original string) string
+	// line returns a new line defining key with the raw value.
+	line(key string, raw string) string
+	// separator is the separator used when flattening mapping keys.
+	separator() string
+}
+
+// keyValueExtender is an [Extender] allowing the modification of line based
+// key/value files like Java properties and dotenv files.
+//
+// Modifications are made in place in the text. Comments, blank lines, ordering
+// and quoting are preserved.
+type keyValueExtender struct {
+	text   []byte
+	format keyValueFormat
+}
+
+// SetPayload stores the payload internally after checking it can be parsed.
+func (e *keyValueExtender) SetPayload(payload []byte) error {
+	if _, err := e.format.entries(payload); err != nil {
+		return err
+	}
+	e.text = payload
+	return nil
+}
+
+// GetPayload returns the current text.
+func (e *keyValueExtender) GetPayload() ([]byte, error) {
+	return e.text, nil
+}
+
+// pathKey returns the key addressed by path. As keys often contain dots, the
+// path segments are joined with dots. A key can also be given as a single
+// segment enclosed in brackets: [spring.datasource.url].
+func pathKey(path []string) (string, error) {
+	if len(path) == 0 {
+		return "", fmt.Errorf("path cannot be empty")
+	}
+	key := strings.Join(path, ".")
+	if len(path) == 1 && strings.HasPrefix(key, "[") && strings.HasSuffix(key, "]") {
+		key = key[1 : len(key)-1]
+	}
+	return key, nil
+}
+
+// Get returns the decoded value of the key at path. If the key is present
+// several times, the last value is returned.
+func (e *keyValueExtender) Get(path []string) ([]byte, error) {
+	key, err := pathKey(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := e.format.entries(e.text)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].key == key {
+			value, err := e.format.decode(string(e.text[entries[i].start:entries[i].end]))
+			return []byte(value), err
+		}
+	}
+	return nil, pathNotFoundError(fmt.Sprintf("key %s not found", key))
+}
+
+// GetNode returns the decoded value of the key at path as a node. If there is
+// no such key, a mapping containing the keys prefixed by the path key and the
+// separator is returned.
+func (e *keyValueExtender) GetNode(path []string) (*yaml.RNode, error) {
+	if value, err := e.Get(path); err == nil {
+		return yaml.NewStringRNode(string(value)), nil
+	}
+	key, err := pathKey(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := e.format.entries(e.text)
+	if err != nil {
+		return nil, err
+	}
+	result := yaml.NewMapRNode(nil)
+	prefix := key + e.format.separator()
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.key, prefix) {
+			continue
+		}
+		value, err := e.format.decode(string(e.text[entry.start:entry.end]))
+		if err != nil {
+			return nil, err
+		}
+		if err := result.PipeE(yaml.SetField(entry.key[len(prefix):], yaml.NewStringRNode(value))); err != nil {
+			return nil, err
+		}
+	}
+	if len(result.Content()) == 0 {
+		return nil, pathNotFoundError(fmt.Sprintf("key %s not found", key))
+	}
+	return result, nil
+}
+
+// setKey sets the value of all the occurrences of key. If key is not present,
+// a new line is appended at the end of the text.
+func (e *keyValueExtender) setKey(key string, value string) error {
+	entries, err := e.format.entries(e.text)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	start := 0
+	found := false
+	for _, entry := range entries {
+		if entry.key == key {
+			b.Write(e.text[start:entry.start])
+			b.WriteString(e.format.encode(value, string(e.text[entry.start:entry.end])))
+			start = entry.end
+			found = true
+		}
+	}
+	if !found {
+		b.Write(e.text)
+		if b.Len() > 0 && !bytes.HasSuffix(e.text, []byte("\n")) {
+			b.WriteString("\n")
+		}
+		b.WriteString(e.format.line(key, e.format.encode(value, "")))
+		b.WriteString("\n")
+	} else {
+		b.Write(e.text[start:])
+	}
+	e.text = b.Bytes()
+	return nil
+}
+
+// Delete removes the lines of all the occurrences of the key at path.
+func (e *keyValueExtender) Delete(path []string) error {
+	key, err := pathKey(path)
+	if err != nil {
+		return err
+	}
+	entries, err := e.format.entries(e.text)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	start := 0
+	for _, entry := range entries {
+		if entry.key == key {
+			b.Write(e.text[start:entry.lineStart])
+			start = entry.lineEnd
+		}
+	}
+	if start < len(e.text) {
+		b.Write(e.text[start:])
+	}
+	e.text = b.Bytes()
+	return nil
+}
+
+// flattenMapping returns the scalar values contained in node indexed by their
+// key path prefixed by prefix and joined by separator.
+func flattenMapping(node *yaml.Node, prefix string, separator string, result map[string]string, keys *[]string) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if _, ok := result[prefix]; !ok {
+			*keys = append(*keys, prefix)
+		}
+		result[prefix] = node.Value
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			key := node.Content[i].Value
+			if prefix != "" {
+				key = prefix + separator + key
+			}
+			if err := flattenMapping(node.Content[i+1], key, separator, result, keys); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot set non scalar value at %s", prefix)
+	}
+	return nil
+}
+
+// Set sets the value of the key at path.
+//
+// If value is a mapping, its scalar values are set with keys composed by the
+// key at path and the key path inside the mapping.
+func (e *keyValueExtender) Set(path []string, value any) error {
+	key, err := pathKey(path)
+	if err != nil {
+		return err
+	}
+	if node, ok := value.(*yaml.Node); ok && node.Kind != yaml.ScalarNode {
+		values := map[string]string{}
+		keys := []string{}
+		if err := flattenMapping(node, key, e.format.separator(), values, &keys); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := e.setKey(k, values[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.setKey(key, string(getByteValue(value)))
+}
+
+/////////////
+// Properties
+/////////////
+
+// propertiesFormat is the Java properties file format.
+type propertiesFormat struct{}
+
+// isPropertiesBlank returns true if c is a properties file whitespace.
+func isPropertiesBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\f'
+}
+
+// isPropertiesEscaped returns true if the character at index i of text is
+// preceded by an odd number of backslashes.
+func isPropertiesEscaped(text []byte, i int) bool {
+	count := 0
+	for j := i - 1; j >= 0 && text[j] == '\\'; j-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// entries returns the entries of the properties file. It follows the rules
+// of java.util.Properties.load: logical lines can span several physical lines
+// when ending with a backslash, keys end at the first unescaped =, : or
+// whitespace.
+func (f propertiesFormat) entries(text []byte) ([]keyValueEntry, error) {
+	result := []keyValueEntry{}
+	for i := 0; i < len(text); {
+		j := i
+		for j < len(text) && isPropertiesBlank(text[j]) {
+			j++
+		}
+		lineEnd := bytes.IndexByte(text[j:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += j
+		}
+		if j == lineEnd || text[j] == '\r' || text[j] == '#' || text[j] == '!' {
+			// blank or comment line
+			i = lineEnd + 1
+			continue
+		}
+
+		// extend to the end of the logical line
+		end := lineEnd
+		for {
+			contentEnd := end
+			if contentEnd > j && text[contentEnd-1] == '\r' {
+				contentEnd--
+			}
+			if end == len(text) || contentEnd == j || text[contentEnd-1] != '\\' || isPropertiesEscaped(text, contentEnd-1) {
+				break
+			}
+			if nl := bytes.IndexByte(text[end+1:], '\n'); nl >= 0 {
+				end += nl + 1
+			} else {
+				end = len(text)
+			}
+		}
+		next := end + 1
+		if end > j && text[end-1] == '\r' {
+			end--
+		}
+
+		keyStart := j
+		for j < end {
+			c := text[j]
+			if (c == '=' || c == ':' || isPropertiesBlank(c)) && !isPropertiesEscaped(text, j) {
+				break
+			}
+			j++
+		}
+		key, err := f.decode(string(text[keyStart:j]))
+		if err != nil {
+			return nil, err
+		}
+		for j < end && isPropertiesBlank(text[j]) {
+			j++
+		}
+		if j < end && (text[j] == '=' || text[j] == ':') {
+			j++
+		}
+		for j < end && isPropertiesBlank(text[j]) {
+			j++
+		}
+		result = append(result, keyValueEntry{key: key, start: j, end: end, lineStart: i, lineEnd: next})
+		i = next
+	}
+	return result, nil
+}
+
+// decode removes continuation lines and escape sequences from raw.
+func (f propertiesFormat) decode(raw string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i == len(raw)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch raw[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(raw) {
+				return "", fmt.Errorf("malformed \\uxxxx encoding in %s", raw)
+			}
+			r, err := strconv.ParseUint(raw[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\uxxxx encoding in %s", raw)
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		case '\r', '\n':
+			// line continuation: skip the line break and the leading
+			// whitespace of the next line
+			if raw[i] == '\r' && i+1 < len(raw) && raw[i+1] == '\n' {
+				i++
+			}
+			for i+1 < len(raw) && (raw[i+1] == ' ' || raw[i+1] == '\t' || raw[i+1] == '\f') {
+				i++
+			}
+		default:
+			b.WriteByte(raw[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// escapeProperty escapes value for inclusion in a properties file. If key is
+// true, separators and comment characters are escaped too.
+func escapeProperty(value string, key bool) string {
+	var b strings.Builder
+	for i, c := range value {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\f':
+			b.WriteString(`\f`)
+		case ' ':
+			if i == 0 || key {
+				b.WriteString(`\ `)
+			} else {
+				b.WriteRune(c)
+			}
+		case '=', ':', '#', '!':
+			if key {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// encode escapes value.
+func (f propertiesFormat) encode(value string, original string) string {
+	return escapeProperty(value, false)
+}
+
+// line returns a key=value line.
+func (f propertiesFormat) line(key string, raw string) string {
+	return escapeProperty(key, true) + "=" + raw
+}
+
+// separator returns the dot used in Java properties hierarchical keys.
+func (f propertiesFormat) separator() string {
+	return "."
+}
+
+// NewPropertiesExtender returns a newly created [Extender] for modifying Java
+// properties files.
+//
+// The key is given by the path. As keys often contain dots, the path segments
+// are joined with dots. For instance, both:
+//
+//	!!properties.spring.datasource.url
+//	!!properties.[spring.datasource.url]
+//
+// address the spring.datasource.url key.
+//
+// The modification is made in place. Comments, blank lines and ordering are
+// preserved. Missing keys are added at the end of the file. If the source is a
+// mapping, each of its scalar values is set with a key composed by the path
+// and the key path inside the mapping.
+func NewPropertiesExtender() Extender {
+	return &keyValueExtender{format: propertiesFormat{}}
+}
+
+//////////
+// Dotenv
+//////////
+
+// envFormat is the dotenv file format.
+type envFormat struct{}
+
+// entries returns the entries of the dotenv file. Lines can start with an
+// optional export keyword. Values can be unquoted, single quoted or double
+// quoted. Quoted values can span several lines.
+func (f envFormat) entries(text []byte) ([]keyValueEntry, error) {
+	result := []keyValueEntry{}
+	i := 0
+	for i < len(text) {
+		lineEnd := bytes.IndexByte(text[i:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += i
+		}
+		line := string(text[i:lineEnd])
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.TrimSpace(trimmed) == "" || trimmed[0] == '#' {
+			i = lineEnd + 1
+			continue
+		}
+		j := i + len(line) - len(trimmed)
+		if strings.HasPrefix(trimmed, "export ") || strings.HasPrefix(trimmed, "export\t") {
+			j += len("export")
+			for j < lineEnd && (text[j] == ' ' || text[j] == '\t') {
+				j++
+			}
+		}
+		eq := bytes.IndexByte(text[j:lineEnd], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid dotenv line %q", line)
+		}
+		key := strings.TrimSpace(string(text[j : j+eq]))
+		j += eq + 1
+		for j < lineEnd && (text[j] == ' ' || text[j] == '\t') {
+			j++
+		}
+
+		start := j
+		end := lineEnd
+		if j < len(text) && (text[j] == '"' || text[j] == '\'') {
+			quote := text[j]
+			k := j + 1
+			for ; k < len(text); k++ {
+				if text[k] == '\\' && quote == '"' {
+					k++
+					continue
+				}
+				if text[k] == quote {
+					break
+				}
+			}
+			if k >= len(text) {
+				return nil, fmt.Errorf("unterminated quoted value for key %s", key)
+			}
+			end = k + 1
+			if nl := bytes.IndexByte(text[end:], '\n'); nl >= 0 {
+				lineEnd = end + nl
+			} else {
+				lineEnd = len(text)
+			}
+		} else {
+			if comment := strings.Index(string(text[start:lineEnd]), " #"); comment >= 0 {
+				end = start + comment
+			}
+			if tab := strings.Index(string(text[start:end]), "\t#"); tab >= 0 {
+				end = start + tab
+			}
+			for end > start && (text[end-1] == ' ' || text[end-1] == '\t' || text[end-1] == '\r') {
+				end--
+			}
+		}
+		result = append(result, keyValueEntry{key: key, start: start, end: end, lineStart: i, lineEnd: lineEnd + 1})
+		i = lineEnd + 1
+	}
+	return result, nil
+}
+
+// decode removes the quotes and, for double quoted values, the escape
+// sequences from raw.
+func (f envFormat) decode(raw string) (string, error) {
+	if len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+		return raw[1 : len(raw)-1], nil
+	}
+	if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		var b strings.Builder
+		raw = raw[1 : len(raw)-1]
+		for i := 0; i < len(raw); i++ {
+			if raw[i] != '\\' || i == len(raw)-1 {
+				b.WriteByte(raw[i])
+				continue
+			}
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(raw[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(raw[i])
+			}
+		}
+		return b.String(), nil
+	}
+	return raw, nil
+}
+
+// quoteEnv returns value enclosed in double quotes with the appropriate
+// escape sequences.
+func quoteEnv(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// encode returns value quoted the same way as original. Unquoted values that
+// would not be read back identically are double quoted.
+func (f envFormat) encode(value string, original string) string {
+	switch {
+	case strings.HasPrefix(original, `"`):
+		return quoteEnv(value)
+	case strings.HasPrefix(original, "'") && !strings.ContainsAny(value, "'\n"):
+		return "'" + value + "'"
+	case strings.ContainsAny(value, " \t\r\n#'\"\\") || value != strings.TrimSpace(value):
+		return quoteEnv(value)
+	}
+	return value
+}
+
+// line returns a KEY=value line.
+func (f envFormat) line(key string, raw string) string {
+	return key + "=" + raw
+}
+
+// separator returns the separator used to flatten mapping keys.
+func (f envFormat) separator() string {
+	return "_"
+}
+
+// NewEnvExtender returns a newly created [Extender] for modifying dotenv
+// files.
+//
+// The path contains the variable name. The modification is made in place.
+// Comments, blank lines, ordering and quoting are preserved. Missing variables
+// are added at the end of the file. If the source is a mapping, each of its
+// scalar values is set with a name composed by the path and the key path
+// inside the mapping joined by underscores.
+func NewEnvExtender() Extender {
+	return &keyValueExtender{format: envFormat{}}
+}
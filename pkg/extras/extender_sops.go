@@ -0,0 +1,125 @@
+package extras
+
+import (
+	"bytes"
+
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+///////
+// Sops
+///////
+
+// sopsExtender manages sops encrypted YAML or JSON content in KRM resources.
+//
+// The content is decrypted with the keys available in the environment and
+// handled by a YAML or JSON extender.
+type sopsExtender struct {
+	store     sops.Store
+	metadata  sops.Metadata // The metadata of the source payload
+	dataKey   []byte
+	encrypted []byte   // The source payload
+	plaintext []byte   // The decrypted source payload
+	decrypted Extender // The extender of the decrypted payload
+}
+
+// SetPayload decrypts the payload and verifies its MAC.
+func (e *sopsExtender) SetPayload(payload []byte) error {
+	format := formats.Yaml
+	e.decrypted = NewYamlExtender()
+	if bytes.HasPrefix(bytes.TrimSpace(payload), []byte("{")) {
+		format = formats.Json
+		e.decrypted = NewJsonExtender()
+	}
+	e.store = common.StoreForFormat(format)
+
+	tree, err := e.store.LoadEncryptedFile(payload)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while loading sops content")
+	}
+	e.dataKey, err = common.DecryptTree(common.DecryptTreeOpts{
+		KeyServices: sopsKeyServices(),
+		Tree:        &tree,
+		Cipher:      aes.NewCipher(),
+	})
+	if err != nil {
+		return errors.WrapPrefixf(err, "while decrypting sops content")
+	}
+	e.plaintext, err = e.store.EmitPlainFile(tree.Branches)
+	if err != nil {
+		return err
+	}
+	e.metadata = tree.Metadata
+	e.encrypted = payload
+	return e.decrypted.SetPayload(e.plaintext)
+}
+
+// GetPayload returns the current payload encrypted with the source metadata.
+//
+// Like with sops --set, the data key, recipients and encryption policy of the
+// source payload are kept while its modification time and MAC are updated.
+// If the content has not been modified, the source payload is returned as is.
+func (e *sopsExtender) GetPayload() ([]byte, error) {
+	plaintext, err := e.decrypted.GetPayload()
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(plaintext, e.plaintext) {
+		return e.encrypted, nil
+	}
+	branches, err := e.store.LoadPlainFile(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	tree := sops.Tree{Branches: branches, Metadata: e.metadata}
+	err = common.EncryptTree(common.EncryptTreeOpts{
+		DataKey: e.dataKey,
+		Tree:    &tree,
+		Cipher:  aes.NewCipher(),
+	})
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while encrypting sops content")
+	}
+	return e.store.EmitEncryptedFile(tree)
+}
+
+// Get returns the decrypted value at path.
+func (e *sopsExtender) Get(path []string) ([]byte, error) {
+	return e.decrypted.Get(path)
+}
+
+// GetNode returns the decrypted node at path.
+func (e *sopsExtender) GetNode(path []string) (*yaml.RNode, error) {
+	return getExtenderNode(e.decrypted, path)
+}
+
+// Set modifies the decrypted content at path with value.
+func (e *sopsExtender) Set(path []string, value any) error {
+	return e.decrypted.Set(path, value)
+}
+
+// Delete removes path from the decrypted content.
+func (e *sopsExtender) Delete(path []string) error {
+	return e.decrypted.Delete(path)
+}
+
+// NewSopsExtender returns a newly created sops extender.
+//
+// It allows modifying values inside sops encrypted YAML or JSON content
+// without leaving the plaintext in the resources:
+//
+//	data.secrets\.yaml.!!sops.stringData.password
+//
+// The decryption keys must be available in the environment (SOPS_AGE_KEY,
+// gpg agent...) and the MAC of the content must be valid. When placed at the
+// beginning of a path, it applies to the whole resource:
+//
+//	!!sops.stringData.password
+func NewSopsExtender() Extender {
+	return &sopsExtender{}
+}
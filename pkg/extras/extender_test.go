@@ -2,11 +2,36 @@ package extras
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lithammer/dedent"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"golang.org/x/crypto/bcrypt"
+	"sigs.k8s.io/kustomize/api/loader"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
 	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 	kyaml_utils "sigs.k8s.io/kustomize/kyaml/utils"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
@@ -382,13 +407,12 @@ targetRevision = 'main'
 [apps]
 enabled = true
 `
-	expected := `uninode = true
-
-[apps]
-enabled = true
-
+	expected := `
+uninode = true
 [common]
 targetRevision = 'deploy/citest'
+[apps]
+enabled = true
 `
 
 	p := `!!toml.common.targetRevision`
@@ -463,6 +487,1991 @@ enabled = true
 	require.Equal("deploy/citest", string(value), "error fetching changed value")
 }
 
+func (s *ExtenderTestSuite) TestXmlExtender() {
+	require := s.Require()
+	source := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Tomcat configuration -->
+<Server port="8005" shutdown="SHUTDOWN">
+  <Service name="Catalina">
+    <!-- HTTP connector -->
+    <Connector port="8080" protocol="HTTP/1.1" connectionTimeout="20000"/>
+    <Engine name="Catalina" defaultHost="localhost">
+      <Host name="localhost" appBase="webapps"/>
+    </Engine>
+  </Service>
+  <Service name="Other">
+    <Connector port="9090" protocol="HTTP/1.1"/>
+  </Service>
+</Server>
+`
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Tomcat configuration -->
+<Server port="8005" shutdown="SHUTDOWN">
+  <Service name="Catalina">
+    <!-- HTTP connector -->
+    <Connector port="8443" protocol="HTTP/1.1" connectionTimeout="20000"/>
+    <Engine name="Catalina" defaultHost="kaweezle.com">
+      <Host name="localhost" appBase="webapps"/>
+    </Engine>
+    <Executor>tomcatThreadPool</Executor>
+  </Service>
+  <Service name="Other">
+    <Connector port="9090" protocol="HTTP/1.1"/>
+  </Service>
+</Server>
+`
+
+	p := `!!xml.Server.Service.[name=Catalina].Connector.@port`
+	path := kyaml_utils.SmarterPathSplitter(p, ".")
+
+	extensions := []*ExtendedSegment{}
+	prefix, err := splitExtendedPath(path, &extensions)
+	require.NoError(err)
+	require.Len(prefix, 0, "There should be no prefix")
+	require.Len(extensions, 1, "There should be 1 extension")
+	require.Equal("xml", extensions[0].Encoding, "The first extension should be xml")
+
+	xmlXP := extensions[0]
+	xmlExt, err := xmlXP.Extender([]byte(source))
+	require.NoError(err)
+	require.IsType(&xmlExtender{}, xmlExt, "Should be a xml extender")
+	value, err := xmlExt.Get(xmlXP.Path)
+	require.NoError(err)
+	require.Equal("8080", string(value), "error fetching value")
+	require.NoError(xmlExt.Set(xmlXP.Path, []byte("8443")))
+	require.NoError(xmlExt.Set([]string{"Server", "Service", "0", "Engine", "@defaultHost"}, []byte("kaweezle.com")))
+	require.NoError(xmlExt.Set([]string{"Server", "Service", "[name=Catalina]", "Executor"}, []byte("tomcatThreadPool")))
+
+	modified, err := xmlExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final xml")
+
+	value, err = xmlExt.Get(xmlXP.Path)
+	require.NoError(err)
+	require.Equal("8443", string(value), "error fetching changed value")
+}
+
+func (s *ExtenderTestSuite) TestXmlExtenderWithMapping() {
+	require := s.Require()
+	source := `<settings xmlns="http://maven.apache.org/SETTINGS/1.0.0">
+  <mirrors>
+    <mirror>
+      <id>central</id>
+      <url>https://repo.maven.apache.org/maven2</url>
+    </mirror>
+  </mirrors>
+</settings>
+`
+	expected := `<settings xmlns="http://maven.apache.org/SETTINGS/1.0.0">
+  <mirrors>
+    <mirror>
+      <id>nexus</id>
+      <url>https://nexus.kaweezle.com/repository/maven</url>
+      <mirrorOf>*</mirrorOf>
+    </mirror>
+  </mirrors>
+</settings>
+`
+	replacements, err := (&kio.ByteReader{Reader: bytes.NewBufferString(`
+mirror:
+  id: nexus
+  url: https://nexus.kaweezle.com/repository/maven
+  mirrorOf: "*"
+`)}).Read()
+	require.NoError(err)
+	value, err := replacements[0].Pipe(yaml.Lookup("mirror"))
+	require.NoError(err)
+
+	xmlExt, err := (&ExtendedSegment{Encoding: "xml"}).Extender([]byte(source))
+	require.NoError(err)
+	require.NoError(xmlExt.Set([]string{"settings", "mirrors", "mirror", "[id=central]"}, value.YNode()))
+
+	modified, err := xmlExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final xml")
+}
+
+func (s *ExtenderTestSuite) TestXmlExtenderKeepsNamespaces() {
+	require := s.Require()
+	source := `<project xmlns="http://maven.apache.org/POM/4.0.0" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://maven.apache.org/POM/4.0.0 http://maven.apache.org/xsd/maven-4.0.0.xsd">
+  <modelVersion>4.0.0</modelVersion>
+  <version>1</version>
+</project>
+`
+	expected := `<project xmlns="http://maven.apache.org/POM/4.0.0" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <version>2</version>
+  <name>x</name>
+</project>
+`
+	value, err := yaml.Parse("{version: '2', name: x}")
+	require.NoError(err)
+
+	xmlExt, err := (&ExtendedSegment{Encoding: "xml"}).Extender([]byte(source))
+	require.NoError(err)
+	require.NoError(xmlExt.Set([]string{"project"}, value.YNode()))
+
+	modified, err := xmlExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "namespace declarations should be kept")
+}
+
+func (s *ExtenderTestSuite) TestXmlExtenderOperations() {
+	require := s.Require()
+	source := `<settings>
+  <mirrors>
+    <mirror id="central">
+      <url>https://repo.maven.apache.org/maven2</url>
+    </mirror>
+  </mirrors>
+  <profiles>
+    <profile>dev</profile>
+    <profile>test</profile>
+  </profiles>
+  <localRepository>/var/</localRepository>
+</settings>
+`
+	expected := `<settings>
+  <mirrors>
+    <mirror id="central">
+      <url>https://nexus.kaweezle.com/repository/maven</url>
+      <mirrorOf>*</mirrorOf>
+    </mirror>
+  </mirrors>
+  <profiles>
+    <profile>dev</profile>
+    <profile>test</profile>
+  </profiles>
+  <localRepository>/var/maven</localRepository>
+</settings>
+`
+	xmlExt := NewXmlExtender()
+	require.NoError(xmlExt.SetPayload([]byte(source)))
+
+	node, err := xmlExt.(NodeExtender).GetNode([]string{"settings", "mirrors", "mirror"})
+	require.NoError(err)
+	require.Equal("'@id': central\nurl: https://repo.maven.apache.org/maven2\n", node.MustString())
+	node, err = xmlExt.(NodeExtender).GetNode([]string{"settings", "profiles"})
+	require.NoError(err)
+	require.Equal("profile:\n- dev\n- test\n", node.MustString())
+
+	merged := yaml.MustParse("url: https://nexus.kaweezle.com/repository/maven\nmirrorOf: \"*\"\n")
+	require.NoError(applyOperation(xmlExt, []string{"settings", "mirrors", "mirror"}, merged.YNode(), MergeOperation))
+	require.NoError(applyOperation(xmlExt, []string{"settings", "localRepository"}, yaml.NewStringRNode("maven").YNode(), AppendOperation))
+	require.NoError(applyOperation(xmlExt, []string{"settings", "servers", "server"}, nil, DeleteOperation), "deleting a missing path is a no-op")
+
+	modified, err := xmlExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final xml")
+
+	err = applyOperation(xmlExt, []string{"settings", "mirrors"}, yaml.NewStringRNode("other").YNode(), AppendOperation)
+	require.Error(err)
+	require.Contains(err.Error(), "use merge instead")
+
+	// Only missing paths fall back to set
+	tomlExt := NewTomlExtender()
+	require.NoError(tomlExt.SetPayload([]byte("name = \"app\"\n")))
+	require.Error(applyOperation(tomlExt, []string{"name", "[a=b]"}, merged.YNode(), MergeOperation))
+	require.NoError(applyOperation(tomlExt, []string{"labels"}, merged.YNode(), MergeOperation))
+}
+
+func (s *ExtenderTestSuite) TestPropertiesExtender() {
+	require := s.Require()
+	source := dedent.Dedent(`
+    # Database configuration
+    spring.datasource.url=jdbc:postgresql://localhost:5432/app
+    spring.datasource.username = app
+
+    ! Logging
+    logging.level.root: INFO
+    app.description = A long \
+        description
+    `)[1:]
+	expected := dedent.Dedent(`
+    # Database configuration
+    spring.datasource.url=jdbc:postgresql://db.kaweezle.com:5432/app
+    spring.datasource.username = app
+
+    ! Logging
+    logging.level.root: DEBUG
+    app.description = A short one
+    server.port=8443
+    `)[1:]
+
+	p := `!!properties.spring.datasource.url`
+	path := kyaml_utils.SmarterPathSplitter(p, ".")
+
+	extensions := []*ExtendedSegment{}
+	prefix, err := splitExtendedPath(path, &extensions)
+	require.NoError(err)
+	require.Len(prefix, 0, "There should be no prefix")
+	require.Len(extensions, 1, "There should be 1 extension")
+	require.Equal("properties", extensions[0].Encoding, "The first extension should be properties")
+
+	propertiesXP := extensions[0]
+	propertiesExt, err := propertiesXP.Extender([]byte(source))
+	require.NoError(err)
+	value, err := propertiesExt.Get(propertiesXP.Path)
+	require.NoError(err)
+	require.Equal("jdbc:postgresql://localhost:5432/app", string(value), "error fetching value")
+	value, err = propertiesExt.Get([]string{"app.description"})
+	require.NoError(err)
+	require.Equal("A long description", string(value), "error fetching multi line value")
+
+	require.NoError(propertiesExt.Set(propertiesXP.Path, []byte("jdbc:postgresql://db.kaweezle.com:5432/app")))
+	require.NoError(propertiesExt.Set([]string{"[logging.level.root]"}, []byte("DEBUG")))
+	require.NoError(propertiesExt.Set([]string{"app", "description"}, []byte("A short one")))
+	require.NoError(propertiesExt.Set([]string{"server", "port"}, []byte("8443")))
+
+	modified, err := propertiesExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final properties")
+}
+
+func (s *ExtenderTestSuite) TestEnvExtender() {
+	require := s.Require()
+	source := dedent.Dedent(`
+    # Application settings
+    export APP_NAME=krmfnbuiltin
+    TARGET_REVISION='main'
+    GREETING="Hello \"world\"" # inline comment
+    DEBUG=false # not in production
+    `)[1:]
+	expected := dedent.Dedent(`
+    # Application settings
+    export APP_NAME=krmfnbuiltin
+    TARGET_REVISION='deploy/citest'
+    GREETING="Hello \"kaweezle\"" # inline comment
+    DEBUG="true # really" # not in production
+    REPO_URL=https://github.com/kaweezle/example.git
+    `)[1:]
+
+	envExt, err := (&ExtendedSegment{Encoding: "env"}).Extender([]byte(source))
+	require.NoError(err)
+
+	value, err := envExt.Get([]string{"GREETING"})
+	require.NoError(err)
+	require.Equal(`Hello "world"`, string(value), "error fetching double quoted value")
+	value, err = envExt.Get([]string{"APP_NAME"})
+	require.NoError(err)
+	require.Equal("krmfnbuiltin", string(value), "error fetching exported value")
+
+	require.NoError(envExt.Set([]string{"TARGET_REVISION"}, []byte("deploy/citest")))
+	require.NoError(envExt.Set([]string{"GREETING"}, []byte(`Hello "kaweezle"`)))
+	require.NoError(envExt.Set([]string{"DEBUG"}, []byte("true # really")))
+	require.NoError(envExt.Set([]string{"REPO_URL"}, []byte("https://github.com/kaweezle/example.git")))
+
+	modified, err := envExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final env")
+}
+
+func (s *ExtenderTestSuite) TestTomlExtenderPreservesLayout() {
+	require := s.Require()
+	source := dedent.Dedent(`
+		# Traefik static configuration
+		[global]
+		  checkNewVersion = true # check for updates
+		  sendAnonymousUsage = false
+
+		[[entryPoints]]
+		  name = "web"
+		  address = ":80"
+
+		[[entryPoints]]
+		  name = "websecure"
+		  address = ":443"
+		  http = { tls = { certResolver = "default" } }
+
+		[log]
+		  level = 'INFO'
+		`)
+	expected := dedent.Dedent(`
+		# Traefik static configuration
+		[global]
+		  checkNewVersion = false # check for updates
+		  sendAnonymousUsage = false
+
+		[[entryPoints]]
+		  name = "web"
+		  address = ":8080"
+
+		[[entryPoints]]
+		  name = "websecure"
+		  address = ":443"
+		  http = { tls = { certResolver = "letsencrypt" } }
+		  timeout = 30
+
+		[log]
+		  level = 'DEBUG'
+		  format = "json"
+		`)
+
+	tomlExt := NewTomlExtender()
+	require.NoError(tomlExt.SetPayload([]byte(source)))
+
+	value, err := tomlExt.Get([]string{"[[entryPoints]]", "[name=web]", "address"})
+	require.NoError(err)
+	require.Equal(":80", string(value))
+	value, err = tomlExt.Get([]string{"entryPoints", "1", "http", "tls", "certResolver"})
+	require.NoError(err)
+	require.Equal("default", string(value))
+
+	require.NoError(tomlExt.Set([]string{"global", "checkNewVersion"}, []byte("false")))
+	require.NoError(tomlExt.Set([]string{"[[entryPoints]]", "[name=web]", "address"}, []byte(":8080")))
+	require.NoError(tomlExt.Set([]string{"entryPoints", "[name=websecure]", "http", "tls", "certResolver"}, []byte("letsencrypt")))
+	require.NoError(tomlExt.Set([]string{"entryPoints", "1", "timeout"}, yaml.NewScalarRNode("30").YNode()))
+
+	mapping := yaml.MustParse("level: DEBUG\nformat: json\n")
+	require.NoError(tomlExt.Set([]string{"log"}, mapping.YNode()))
+
+	modified, err := tomlExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final toml")
+
+	err = tomlExt.Set([]string{"entryPoints", "[name=metrics]", "address"}, []byte(":8082"))
+	require.Error(err)
+}
+
+func (s *ExtenderTestSuite) TestTomlExtenderValueTypes() {
+	require := s.Require()
+	tomlExt := NewTomlExtender()
+	require.NoError(tomlExt.SetPayload([]byte("port = 80\nx = [1, 2, 3]\nt = { a = 1, b = \"c\" }\n")))
+
+	require.NoError(tomlExt.Set([]string{"port"}, []byte("1\nextra = 2")))
+	require.NoError(tomlExt.Set([]string{"x", "1"}, []byte("9")))
+	require.NoError(tomlExt.Set([]string{"x", "2"}, []byte("nine")))
+	require.NoError(tomlExt.Set([]string{"t", "a"}, []byte("2")))
+	require.NoError(tomlExt.Set([]string{"t", "b"}, []byte("3")))
+
+	modified, err := tomlExt.GetPayload()
+	require.NoError(err)
+	require.Equal("port = \"1\\nextra = 2\"\nx = [1, 9, \"nine\"]\nt = { a = 2, b = \"3\" }\n", string(modified))
+}
+
+func (s *ExtenderTestSuite) TestTomlExtenderInlineValues() {
+	require := s.Require()
+	tomlExt := NewTomlExtender()
+	require.NoError(tomlExt.SetPayload([]byte(dedent.Dedent(`
+		ports = [ 8000, 8001 ]
+		hosts = [
+		  "a.example.com", # first
+		  "b.example.com",
+		]
+		server = {host='localhost',  port = 80}
+		`))))
+
+	require.NoError(tomlExt.Set([]string{"ports", "1"}, []byte("9000")))
+	require.NoError(tomlExt.Set([]string{"hosts", "0"}, []byte("c.example.com")))
+	require.NoError(tomlExt.Set([]string{"server", "host"}, []byte("example.com")))
+	require.NoError(tomlExt.Set([]string{"server", "tls"}, []byte("true")))
+	require.NoError(tomlExt.Delete([]string{"server", "port"}))
+	require.NoError(tomlExt.Delete([]string{"hosts", "1"}))
+
+	modified, err := tomlExt.GetPayload()
+	require.NoError(err)
+	require.Equal(dedent.Dedent(`
+		ports = [ 8000, 9000 ]
+		hosts = [
+		  "c.example.com", # first
+		]
+		server = {host='example.com',  tls = "true"}
+		`), string(modified))
+}
+
+func (s *ExtenderTestSuite) TestTomlExtenderTablesAndLineEndings() {
+	require := s.Require()
+	source := "[log]\r\n# verbose\r\nlevel = 'DEBUG'\r\nformat = \"json\"\r\n\r\n[api]\r\ninsecure = true\r\n"
+
+	tomlExt := NewTomlExtender()
+	require.NoError(tomlExt.SetPayload([]byte(source)))
+
+	value, err := tomlExt.Get([]string{"log"})
+	require.NoError(err)
+	require.Equal("# verbose\r\nlevel = 'DEBUG'\r\nformat = \"json\"\r\n", string(value), "table text should be kept")
+
+	require.NoError(tomlExt.Set([]string{"log", "file"}, []byte("/var/log/traefik.log")))
+	modified, err := tomlExt.GetPayload()
+	require.NoError(err)
+	require.Equal("[log]\r\n# verbose\r\nlevel = 'DEBUG'\r\nformat = \"json\"\r\nfile = \"/var/log/traefik.log\"\r\n\r\n[api]\r\ninsecure = true\r\n", string(modified))
+}
+
+func (s *ExtenderTestSuite) TestIniExtenderShadowedKeys() {
+	require := s.Require()
+	iniExt := NewIniExtender()
+	require.NoError(iniExt.SetPayload([]byte("[upstream]\nserver = a\nserver = b\nport = 80\n")))
+
+	require.NoError(iniExt.Set([]string{"upstream", "server"}, []byte("c")))
+	modified, err := iniExt.GetPayload()
+	require.NoError(err)
+	require.Equal("[upstream]\nserver = c\nport   = 80\n", string(modified), "a scalar should replace all the values")
+
+	require.NoError(iniExt.Set([]string{"upstream", "server", "1"}, []byte("d")))
+	value, err := iniExt.Get([]string{"upstream", "server", "1"})
+	require.NoError(err)
+	require.Equal("d", string(value))
+}
+
+func (s *ExtenderTestSuite) TestIniExtenderSections() {
+	require := s.Require()
+	source := dedent.Dedent(`
+		uninode = true
+		; common settings
+		[common]
+		targetRevision = main
+		repoURL = https://github.com/antoinemartin/autocloud.git
+		[apps]
+		enabled = true
+		[remote "origin"]
+		fetch = +refs/heads/*:refs/remotes/origin/*
+		fetch = +refs/tags/*:refs/tags/*
+		`)
+	expected := `uninode = true
+
+; common settings
+[common]
+targetRevision = deploy/citest
+# overridden
+enabled        = false
+
+[remote "origin"]
+fetch = +refs/heads/*:refs/remotes/origin/*
+fetch = +refs/pull/*:refs/remotes/origin/pull/*
+
+[cluster]
+name = citest
+`
+
+	iniExt := NewIniExtender()
+	require.NoError(iniExt.SetPayload([]byte(source)))
+
+	value, err := iniExt.Get([]string{"[remote \"origin\"]", "fetch", "1"})
+	require.NoError(err)
+	require.Equal("+refs/tags/*:refs/tags/*", string(value))
+
+	value, err = iniExt.Get([]string{"apps"})
+	require.NoError(err)
+	require.Equal("enabled = true\n", string(value))
+
+	common := yaml.MustParse(dedent.Dedent(`
+		targetRevision: deploy/citest
+		# overridden
+		enabled: false
+		`))
+	require.NoError(iniExt.Set([]string{"common"}, common.YNode()))
+	require.NoError(iniExt.Set([]string{"[common]", "enabled"}, []byte("false")))
+	require.NoError(iniExt.Set([]string{"[remote \"origin\"]", "fetch", "1"}, []byte("+refs/pull/*:refs/remotes/origin/pull/*")))
+	require.NoError(iniExt.Set([]string{"apps"}, yaml.MakeNullNode().YNode()))
+	require.NoError(iniExt.Set([]string{"cluster"}, yaml.MustParse("name: citest").YNode()))
+
+	modified, err := iniExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final ini")
+
+	require.NoError(iniExt.Set([]string{"[remote \"origin\"]", "fetch", "0"}, yaml.MakeNullNode().YNode()))
+	value, err = iniExt.Get([]string{"[remote \"origin\"]", "fetch"})
+	require.NoError(err)
+	require.Equal("+refs/pull/*:refs/remotes/origin/pull/*", string(value))
+}
+
+func (s *ExtenderTestSuite) TestHclExtender() {
+	require := s.Require()
+	source := dedent.Dedent(`
+		# Logs bucket
+		resource "aws_s3_bucket" "logs" {
+		  bucket = "my-logs" # bucket name
+		  force_destroy = false
+
+		  tags = {
+		    Environment = "dev"
+		  }
+
+		  versioning {
+		    enabled = false
+		  }
+		}
+
+		resource "aws_s3_bucket" "data" {
+		  bucket = var.data_bucket
+		}
+		`)
+	expected := dedent.Dedent(`
+		# Logs bucket
+		resource "aws_s3_bucket" "logs" {
+		  bucket        = "citest-logs" # bucket name
+		  force_destroy = true
+
+		  tags = {
+		    Environment = "citest"
+		  }
+
+		  versioning {
+		    enabled = true
+		    mfa     = "off"
+		  }
+		}
+
+		`)
+
+	p := `spec.hcl.!!hcl.resource.aws_s3_bucket.logs.bucket`
+	path := kyaml_utils.SmarterPathSplitter(p, ".")
+
+	extensions := []*ExtendedSegment{}
+	prefix, err := splitExtendedPath(path, &extensions)
+	require.NoError(err)
+	require.Equal([]string{"spec", "hcl"}, prefix)
+	require.Len(extensions, 1, "There should be 1 extension")
+	require.Equal("hcl", extensions[0].Encoding)
+
+	hclExt, err := extensions[0].Extender([]byte(source))
+	require.NoError(err)
+	value, err := hclExt.Get(extensions[0].Path)
+	require.NoError(err)
+	require.Equal("my-logs", string(value))
+
+	value, err = hclExt.Get([]string{"resource", "aws_s3_bucket", "data", "bucket"})
+	require.NoError(err)
+	require.Equal("var.data_bucket", string(value))
+
+	value, err = hclExt.Get([]string{"resource", "aws_s3_bucket", "logs", "tags", "Environment"})
+	require.NoError(err)
+	require.Equal("dev", string(value))
+
+	require.NoError(hclExt.Set(extensions[0].Path, []byte("citest-logs")))
+	require.NoError(hclExt.Set([]string{"resource", "aws_s3_bucket", "logs", "force_destroy"}, []byte("true")))
+	require.NoError(hclExt.Set([]string{"resource", "aws_s3_bucket", "logs", "tags", "Environment"}, []byte("citest")))
+	versioning := yaml.MustParse("versioning:\n  enabled: true\n  mfa: \"off\"\n")
+	require.NoError(hclExt.Set([]string{"resource", "aws_s3_bucket", "logs"}, versioning.YNode()))
+	require.NoError(hclExt.Set([]string{"resource", "aws_s3_bucket", "data"}, yaml.MakeNullNode().YNode()))
+
+	modified, err := hclExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final hcl")
+}
+
+func (s *ExtenderTestSuite) TestGzipExtender() {
+	require := s.Require()
+
+	release := `{"name":"traefik","chart":{"metadata":{"name":"traefik","version":"10.19.4"}},"version":1}`
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(release))
+	require.NoError(err)
+	require.NoError(writer.Close())
+	encoded := base64.StdEncoding.EncodeToString([]byte(base64.StdEncoding.EncodeToString(compressed.Bytes())))
+
+	p := `data.release.!!base64.!!base64.!!gzip.!!json.chart.metadata.version`
+	ep, err := NewExtendedPath(kyaml_utils.SmarterPathSplitter(p, "."))
+	require.NoError(err)
+	require.Equal([]string{"data", "release"}, ep.ResourcePath)
+	require.Len(*ep.ExtendedSegments, 4, "There should be 4 extensions")
+
+	apply := func() string {
+		target := yaml.NewStringRNode(encoded)
+		require.NoError(ep.Apply(target, yaml.NewStringRNode("10.19.5")))
+		return target.YNode().Value
+	}
+	modified := apply()
+	require.Equal(modified, apply(), "output should be deterministic")
+
+	decoded, err := base64.StdEncoding.DecodeString(modified)
+	require.NoError(err)
+	decoded, err = base64.StdEncoding.DecodeString(string(decoded))
+	require.NoError(err)
+	gzipExt := NewGzipExtender()
+	require.NoError(gzipExt.SetPayload(decoded))
+	uncompressed, err := gzipExt.Get([]string{})
+	require.NoError(err)
+	jsonExt := NewJsonExtender()
+	require.NoError(jsonExt.SetPayload(uncompressed))
+	version, err := jsonExt.Get([]string{"chart", "metadata", "version"})
+	require.NoError(err)
+	require.Equal("10.19.5", string(version))
+
+	// Unmodified content is kept as is
+	require.NoError(gzipExt.Set([]string{}, uncompressed))
+	payload, err := gzipExt.GetPayload()
+	require.NoError(err)
+	require.Equal(decoded, payload)
+
+	// Concatenated members are rejected
+	require.Error(NewGzipExtender().SetPayload(append(append([]byte{}, compressed.Bytes()...), compressed.Bytes()...)))
+
+	zlibExt := NewZlibExtender()
+	var zlibCompressed bytes.Buffer
+	zwriter := zlib.NewWriter(&zlibCompressed)
+	_, err = zwriter.Write([]byte(release))
+	require.NoError(err)
+	require.NoError(zwriter.Close())
+	require.NoError(zlibExt.SetPayload(zlibCompressed.Bytes()))
+	value, err := zlibExt.Get([]string{})
+	require.NoError(err)
+	require.Equal(release, string(value))
+	require.Error(zlibExt.Set([]string{"version"}, []byte("2")))
+}
+
+func (s *ExtenderTestSuite) TestYamlExtenderMultiDocument() {
+	require := s.Require()
+	source := dedent.Dedent(`
+		# Namespace
+		apiVersion: v1
+		kind: Namespace
+		metadata:
+		    name: traefik
+		---
+		apiVersion: apps/v1
+		kind: Deployment
+		metadata:
+		  name: traefik
+		  namespace: traefik
+		spec:
+		  replicas: 1 # single replica
+		---
+		apiVersion: v1
+		kind:   Service
+		metadata:
+		  name: traefik
+		`)
+	expected := dedent.Dedent(`
+		# Namespace
+		apiVersion: v1
+		kind: Namespace
+		metadata:
+		    name: traefik
+		---
+		apiVersion: apps/v1
+		kind: Deployment
+		metadata:
+		  name: traefik
+		  namespace: traefik
+		spec:
+		  replicas: 3 # single replica
+		---
+		apiVersion: v1
+		kind: Service
+		metadata:
+		  name: traefik-lb
+		`)
+
+	yamlExt := NewYamlExtender()
+	require.NoError(yamlExt.SetPayload([]byte(source)))
+
+	value, err := yamlExt.Get([]string{"[kind=Deployment,name=traefik]", "spec", "replicas"})
+	require.NoError(err)
+	require.Equal("1", string(value))
+	value, err = yamlExt.Get([]string{"[2]", "kind"})
+	require.NoError(err)
+	require.Equal("Service", string(value))
+	value, err = yamlExt.Get([]string{"kind"})
+	require.NoError(err)
+	require.Equal("Namespace", string(value), "first document should be used without selector")
+
+	require.NoError(yamlExt.Set([]string{"[kind=Deployment,name=traefik]", "spec", "replicas"}, yaml.NewScalarRNode("3").YNode()))
+	require.NoError(yamlExt.Set([]string{"[2]", "metadata", "name"}, []byte("traefik-lb")))
+
+	modified, err := yamlExt.GetPayload()
+	require.NoError(err)
+	require.Equal(expected, string(modified), "final yaml")
+
+	_, err = yamlExt.Get([]string{"[kind=ConfigMap]", "data"})
+	require.Error(err)
+
+	// Bare sequence documents and separators followed by content
+	require.NoError(yamlExt.SetPayload([]byte("- name: a\n  value: 1\n- name: b\n  value: 2\n--- {kind: Config, value: 3}\n--- !tagged\nvalue: 4\n")))
+	value, err = yamlExt.Get([]string{"[name=b]", "value"})
+	require.NoError(err)
+	require.Equal("2", string(value))
+	value, err = yamlExt.Get([]string{"[kind=Config]", "value"})
+	require.NoError(err)
+	require.Equal("3", string(value))
+	value, err = yamlExt.Get([]string{"[2]", "value"})
+	require.NoError(err)
+	require.Equal("4", string(value))
+	value, err = yamlExt.Get([]string{"1", "name"})
+	require.NoError(err)
+	require.Equal("b", string(value), "indexes without brackets should address the first document")
+	require.NoError(yamlExt.Set([]string{"[0]", "[name=a]", "value"}, []byte("5")))
+	require.NoError(yamlExt.Set([]string{"[1]", "value"}, yaml.NewScalarRNode("6").YNode()))
+	modified, err = yamlExt.GetPayload()
+	require.NoError(err)
+	require.Equal("- name: a\n  value: 5\n- name: b\n  value: 2\n---\n{kind: Config, value: 6}\n--- !tagged\nvalue: 4\n", string(modified))
+
+	// The selection doesn't depend on the number of documents
+	require.NoError(yamlExt.SetPayload([]byte("- name: a\n- name: b\n")))
+	value, err = yamlExt.Get([]string{"1", "name"})
+	require.NoError(err)
+	require.Equal("b", string(value))
+	value, err = yamlExt.Get([]string{"[0]", "1", "name"})
+	require.NoError(err)
+	require.Equal("b", string(value))
+}
+
+// makeCertificate returns a PEM encoded self signed certificate for cn.
+func makeCertificate(cn string, dnsNames ...string) (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"kaweezle"}},
+		NotBefore:             time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2033, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:              dnsNames,
+		IsCA:                  len(dnsNames) == 0,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
+
+func (s *ExtenderTestSuite) TestPemExtender() {
+	require := s.Require()
+	leaf, err := makeCertificate("webhook", "webhook.default.svc", "webhook.default.svc.cluster.local")
+	require.NoError(err)
+	ca, err := makeCertificate("root-ca")
+	require.NoError(err)
+	newCa, err := makeCertificate("new-root-ca")
+	require.NoError(err)
+	source := "# Leaf\n" + leaf + "# CA\n" + ca
+
+	p := `data.ca\.crt.!!pem.[subject.cn=root-ca].notAfter`
+	ep, err := NewExtendedPath(kyaml_utils.SmarterPathSplitter(p, "."))
+	require.NoError(err)
+	require.Equal([]string{"data", "ca.crt"}, ep.ResourcePath)
+	segment := (*ep.ExtendedSegments)[0]
+	require.Equal("pem", segment.Encoding)
+
+	pemExt, err := segment.Extender([]byte(source))
+	require.NoError(err)
+	value, err := pemExt.Get(segment.Path)
+	require.NoError(err)
+	require.Equal("2033-01-01T00:00:00Z", string(value))
+
+	value, err = pemExt.Get([]string{"subject", "cn"})
+	require.NoError(err)
+	require.Equal("webhook", string(value), "first block should be used without selector")
+
+	value, err = pemExt.Get([]string{"0", "sans", "1"})
+	require.NoError(err)
+	require.Equal("webhook.default.svc.cluster.local", string(value))
+
+	value, err = pemExt.Get([]string{"1", "isCA"})
+	require.NoError(err)
+	require.Equal("true", string(value))
+
+	value, err = pemExt.Get([]string{"1", "fingerprint"})
+	require.NoError(err)
+	block, _ := pem.Decode([]byte(ca))
+	sum := sha256.Sum256(block.Bytes)
+	require.Equal(hex.EncodeToString(sum[:]), string(value))
+
+	value, err = pemExt.Get([]string{"[subject.cn=root-ca]"})
+	require.NoError(err)
+	require.Equal(ca, string(value))
+
+	require.Error(pemExt.Set([]string{"1", "subject", "cn"}, []byte("other")))
+	require.NoError(pemExt.Set([]string{"[subject.cn=root-ca]"}, []byte(newCa)))
+	require.NoError(pemExt.Set([]string{"0"}, yaml.MakeNullNode().YNode()))
+
+	modified, err := pemExt.GetPayload()
+	require.NoError(err)
+	require.Equal("# CA\n"+newCa, string(modified))
+
+	// As a replacement source
+	nodes, err := kio.FromBytes([]byte(dedent.Dedent(`
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: webhook-tls
+		stringData:
+		  ca.crt: ""
+		---
+		apiVersion: admissionregistration.k8s.io/v1
+		kind: ValidatingWebhookConfiguration
+		metadata:
+		  name: webhook
+		`)))
+	require.NoError(err)
+	require.NoError(nodes[0].PipeE(yaml.Lookup("stringData"), yaml.SetField("ca.crt", yaml.NewStringRNode(source))))
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    kind: Secret
+		    fieldPath: stringData.ca\.crt.!!pem.[subject.cn=root-ca].notAfter
+		  targets:
+		    - select:
+		        kind: ValidatingWebhookConfiguration
+		      fieldPaths:
+		        - metadata.annotations.ca-expiry
+		      options:
+		        create: true
+		`)), &replacements))
+	nodes, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.NoError(err)
+	require.Equal("2033-01-01T00:00:00Z", nodes[1].GetAnnotations()["ca-expiry"])
+}
+
+func (s *ExtenderTestSuite) TestExtendedPathGet() {
+	require := s.Require()
+	source := yaml.MustParse(dedent.Dedent(`
+		apiVersion: argoproj.io/v1alpha1
+		kind: Application
+		metadata:
+		  name: traefik
+		spec:
+		  source:
+		    helm:
+		      values: |
+		        common:
+		          repoURL: https://github.com/kaweezle/autocloud.git
+		          targetRevision: main
+		        replicas: 2
+		`))
+
+	get := func(p string) *yaml.RNode {
+		ep, err := NewExtendedPath(kyaml_utils.SmarterPathSplitter(p, "."))
+		require.NoError(err)
+		value, err := ep.Get(source)
+		require.NoError(err)
+		return value
+	}
+
+	value := get("spec.source.helm.values.!!yaml.common.repoURL")
+	require.Equal(yaml.ScalarNode, value.YNode().Kind)
+	require.Equal("https://github.com/kaweezle/autocloud.git", value.YNode().Value)
+
+	value = get("spec.source.helm.values.!!yaml.common")
+	require.Equal(yaml.MappingNode, value.YNode().Kind, "structured values should be kept")
+	require.Equal("main", value.Field("targetRevision").Value.YNode().Value)
+
+	value = get("spec.source.helm.values.!!regex.replicas: (\\d+).1")
+	require.Equal(yaml.NodeTagString, value.YNode().Tag)
+	require.Equal("2", value.YNode().Value)
+
+	require.Nil(get("spec.source.path"))
+}
+
+func (s *ExtenderTestSuite) TestReplacementWithExtendedSource() {
+	require := s.Require()
+	nodes, err := kio.FromBytes([]byte(dedent.Dedent(`
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: config
+		data:
+		  config.json: eyJzZXJ2ZXIiOnsidXJsIjoiaHR0cHM6Ly9leGFtcGxlLmNvbSJ9fQ==
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: target
+		data:
+		  url: to-replace
+		`)))
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    kind: Secret
+		    name: config
+		    fieldPath: data.config\.json.!!base64.!!json.server.url
+		  targets:
+		    - select:
+		        kind: ConfigMap
+		      fieldPaths:
+		        - data.url
+		`)), &replacements))
+
+	nodes, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.NoError(err)
+	require.Equal("https://example.com", nodes[1].Field("data").Value.Field("url").Value.YNode().Value)
+}
+
+func (s *ExtenderTestSuite) TestExtenderDelete() {
+	require := s.Require()
+
+	tests := []struct {
+		encoding string
+		path     string
+		source   string
+		expected string
+	}{
+		{
+			encoding: "toml",
+			path:     "[[entryPoints]].[name=web]",
+			source: dedent.Dedent(`
+				# Entry points
+				[[entryPoints]]
+				name = "web"
+				address = ":80"
+
+				[[entryPoints]]
+				name = "websecure"
+				address = ":443"
+				ports = [80, 443]
+				`)[1:],
+			expected: dedent.Dedent(`
+				# Entry points
+
+				[[entryPoints]]
+				name = "websecure"
+				address = ":443"
+				ports = [80, 443]
+				`)[1:],
+		},
+		{
+			encoding: "toml",
+			path:     "entryPoints.0.ports.0",
+			source: dedent.Dedent(`
+				[[entryPoints]]
+				name = "web"
+				ports = [80, 443]
+				`)[1:],
+			expected: dedent.Dedent(`
+				[[entryPoints]]
+				name = "web"
+				ports = [443]
+				`)[1:],
+		},
+		{
+			encoding: "ini",
+			path:     "database.password",
+			source: dedent.Dedent(`
+				[database]
+				user = app
+				password = secret
+				`)[1:],
+			expected: dedent.Dedent(`
+				[database]
+				user = app
+				`)[1:],
+		},
+		{
+			encoding: "xml",
+			path:     "Server.Service.Connector.[port=8009]",
+			source: dedent.Dedent(`
+				<Server>
+				  <Service>
+				    <Connector port="8080"/>
+				    <Connector port="8009"/>
+				  </Service>
+				</Server>
+				`)[1:],
+			expected: dedent.Dedent(`
+				<Server>
+				  <Service>
+				    <Connector port="8080"/>
+				  </Service>
+				</Server>
+				`)[1:],
+		},
+		{
+			encoding: "properties",
+			path:     "spring.datasource.password",
+			source: dedent.Dedent(`
+				spring.datasource.url=jdbc:postgresql://localhost:5432/app
+				spring.datasource.password=very \
+				    secret
+				# Logging
+				logging.level.root=INFO
+				`)[1:],
+			expected: dedent.Dedent(`
+				spring.datasource.url=jdbc:postgresql://localhost:5432/app
+				# Logging
+				logging.level.root=INFO
+				`)[1:],
+		},
+		{
+			encoding: "env",
+			path:     "PASSWORD",
+			source: dedent.Dedent(`
+				USER=app
+				PASSWORD="multi
+				line"
+				export HOST=localhost
+				`)[1:],
+			expected: dedent.Dedent(`
+				USER=app
+				export HOST=localhost
+				`)[1:],
+		},
+		{
+			encoding: "yaml",
+			path:     "spec.containers.[name=sidecar]",
+			source: dedent.Dedent(`
+				spec:
+				  containers:
+				    - name: app
+				    - name: sidecar
+				`)[1:],
+			expected: dedent.Dedent(`
+				spec:
+				  containers:
+				    - name: app
+				`)[1:],
+		},
+	}
+
+	for _, test := range tests {
+		segment := &ExtendedSegment{Encoding: test.encoding, Path: kyaml_utils.SmarterPathSplitter(test.path, ".")}
+		extender, err := segment.Extender([]byte(test.source))
+		require.NoError(err, test.encoding)
+		require.NoError(extender.Delete(segment.Path), test.encoding)
+		payload, err := extender.GetPayload()
+		require.NoError(err, test.encoding)
+		require.Equal(test.expected, string(payload), test.encoding)
+	}
+}
+
+func (s *ExtenderTestSuite) TestReplacementOperations() {
+	require := s.Require()
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: source
+		data:
+		  host: db.kaweezle.com
+		  labels: |
+		    tier: backend
+		---
+		apiVersion: apps/v1
+		kind: Deployment
+		metadata:
+		  name: app
+		  labels:
+		    app: app
+		    obsolete: "true"
+		spec:
+		  template:
+		    spec:
+		      containers:
+		        - name: app
+		          args: ["--verbose"]
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: target
+		data:
+		  hosts: localhost,example.com
+		  config.yaml: |
+		    # Configuration
+		    database:
+		      host: localhost
+		      password: secret
+		    hosts:
+		      - localhost
+		  config.json: |
+		    {"labels": {"app": "app"}}
+		`))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- targets:
+		    - select:
+		        kind: Deployment
+		      fieldPaths:
+		        - metadata.labels.obsolete
+		      options:
+		        operation: delete
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.config\.yaml.!!yaml.database.password
+		      options:
+		        operation: delete
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.hosts
+		      options:
+		        delimiter: ","
+		        index: 0
+		        operation: delete
+		- source:
+		    name: source
+		    fieldPath: data.host
+		  targets:
+		    - select:
+		        kind: Deployment
+		      fieldPaths:
+		        - spec.template.spec.containers.[name=app].args
+		      options:
+		        operation: append
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.config\.yaml.!!yaml.hosts
+		      options:
+		        operation: append
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.hosts
+		      options:
+		        delimiter: ","
+		        operation: append
+		- source:
+		    name: source
+		    fieldPath: data.labels.!!yaml
+		  targets:
+		    - select:
+		        kind: Deployment
+		      fieldPaths:
+		        - metadata.labels
+		      options:
+		        operation: merge
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.config\.json.!!json.labels
+		      options:
+		        operation: merge
+		`)), &replacements))
+
+	nodes, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.NoError(err)
+
+	deployment, err := nodes[1].String()
+	require.NoError(err)
+	require.Equal(dedent.Dedent(`
+		apiVersion: apps/v1
+		kind: Deployment
+		metadata:
+		  name: app
+		  labels:
+		    app: app
+		    tier: backend
+		spec:
+		  template:
+		    spec:
+		      containers:
+		      - name: app
+		        args: ["--verbose", db.kaweezle.com]
+		`)[1:], deployment)
+
+	data := nodes[2].Field("data").Value
+	require.Equal("example.com,db.kaweezle.com", data.Field("hosts").Value.YNode().Value)
+	require.Equal(dedent.Dedent(`
+		# Configuration
+		database:
+		  host: localhost
+		hosts:
+		  - localhost
+		  - db.kaweezle.com
+		`)[1:], data.Field("config.yaml").Value.YNode().Value)
+	require.JSONEq(`{"labels": {"app": "app", "tier": "backend"}}`, data.Field("config.json").Value.YNode().Value)
+
+	_, err = extendedFilter{Replacements: []Replacement{{
+		Targets: []*TargetSelector{{Select: &types.Selector{}, FieldPaths: []string{"data.hosts"}}},
+	}}}.Filter(nodes)
+	require.Error(err, "a source is needed by replace operations")
+}
+
+func (s *ExtenderTestSuite) TestReplacementTemplate() {
+	require := s.Require()
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: cluster
+		data:
+		  domainPrefix: Argo
+		  dnsZone: kaweezle.com.
+		  values.yaml: |
+		    hosts:
+		      - one
+		      - two
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: target
+		data:
+		  url: to-replace
+		  hosts: to-replace
+		`))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- sources:
+		    prefix:
+		      name: cluster
+		      fieldPath: data.domainPrefix
+		    zone:
+		      name: cluster
+		      fieldPath: data.dnsZone
+		  template: https://{{ .prefix | lower }}.{{ .zone | trimSuffix "." }}/callback
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.url
+		- sources:
+		    values:
+		      name: cluster
+		      fieldPath: data.values\.yaml.!!yaml
+		  template: '{{ join "," .values.hosts }}:{{ "a" | b64enc }}:{{ "a" | sha256sum }}'
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.hosts
+		`)), &replacements))
+
+	nodes, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.NoError(err)
+	data := nodes[1].Field("data").Value
+	require.Equal("https://argo.kaweezle.com/callback", data.Field("url").Value.YNode().Value)
+	require.Equal("one,two:YQ==:ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", data.Field("hosts").Value.YNode().Value)
+
+	replacements[0].Template = "{{ .unknown }}"
+	_, err = extendedFilter{Replacements: replacements[:1]}.Filter(nodes)
+	require.Error(err, "missing template values should fail")
+}
+
+func (s *ExtenderTestSuite) TestReplacementSourceSets() {
+	require := s.Require()
+	read := func(content string) []*yaml.RNode {
+		nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(content))}).Read()
+		require.NoError(err)
+		return nodes
+	}
+
+	global := read(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: values
+		data:
+		  dnsZone: kaweezle.com
+		  targetRevision: main
+		`)
+	cluster := read(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: values
+		data:
+		  targetRevision: deploy/citest
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: cluster
+		data:
+		  name: citest
+		`)
+	merged, err := mergeSourceNodes(global, cluster)
+	require.NoError(err)
+	require.Len(merged, 2, "resources with the same id should be merged")
+	data := merged[0].Field("data").Value
+	require.Equal("kaweezle.com", data.Field("dnsZone").Value.YNode().Value)
+	require.Equal("deploy/citest", data.Field("targetRevision").Value.YNode().Value, "later sources should win")
+	require.Equal("main", global[0].Field("data").Value.Field("targetRevision").Value.YNode().Value, "sources should not be modified")
+
+	nodes := read(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: local
+		data:
+		  owner: kaweezle
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: target
+		data:
+		  revision: to-replace
+		  owner: to-replace
+		`)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- sourceSet: cluster
+		  source:
+		    name: values
+		    fieldPath: data.targetRevision
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.revision
+		- sourceSet: cluster
+		  source:
+		    name: local
+		    fieldPath: data.owner
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.owner
+		`)), &replacements))
+
+	filter := extendedFilter{Replacements: replacements, sourceSets: map[string][]*yaml.RNode{"cluster": merged}}
+	nodes, err = filter.Filter(nodes)
+	require.NoError(err)
+	data = nodes[1].Field("data").Value
+	require.Equal("deploy/citest", data.Field("revision").Value.YNode().Value)
+	require.Equal("kaweezle", data.Field("owner").Value.YNode().Value, "in-pipeline resources should be used as fallback")
+
+	replacements[1].SourceSet = ""
+	filter = extendedFilter{Replacements: replacements[1:], sourceSets: map[string][]*yaml.RNode{"": merged}}
+	_, err = filter.Filter(nodes)
+	require.True(isSourceNotFound(err), "source and sources should not fall back to in-pipeline resources: %v", err)
+
+	replacements[0].SourceSet = "unknown"
+	_, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.Error(err, "unknown source sets should fail")
+}
+
+func (s *ExtenderTestSuite) TestReplacementMissingSources() {
+	require := s.Require()
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: global
+		data:
+		  revision: main
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: target
+		  labels:
+		    app: to-replace
+		data:
+		  revision: to-replace
+		  zone: to-replace
+		  untouched: untouched
+		`))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    name: environment
+		    fieldPath: data.revision
+		  fallback:
+		    name: global
+		    fieldPath: data.revision
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.revision
+		- source:
+		    name: global
+		    fieldPath: data.zone
+		  default: kaweezle.com
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.zone
+		- source:
+		    name: global
+		    fieldPath: metadata.labels
+		  default:
+		    app: demo
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - metadata.labels
+		- source:
+		    name: environment
+		    fieldPath: data.untouched
+		  optional: true
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.untouched
+		`)), &replacements))
+
+	results := framework.Results{}
+	nodes, err = extendedFilter{Replacements: replacements, results: &results}.Filter(nodes)
+	require.NoError(err)
+	data := nodes[1].Field("data").Value
+	require.Equal("main", data.Field("revision").Value.YNode().Value)
+	require.Equal("kaweezle.com", data.Field("zone").Value.YNode().Value)
+	require.Equal(map[string]string{"app": "demo"}, nodes[1].GetLabels())
+	require.Equal("untouched", data.Field("untouched").Value.YNode().Value)
+	require.Len(results, 1, "the optional replacement should be reported as skipped")
+	require.Contains(results[0].Message, "replacement 3 skipped")
+
+	replacements[3].Optional = false
+	_, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.Error(err, "missing sources should fail when not optional")
+}
+
+func (s *ExtenderTestSuite) TestReplacementMissingExtendedSources() {
+	require := s.Require()
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: source
+		data:
+		  values.yaml: |
+		    common:
+		      revision: main
+		  config.json: |
+		    {"common": {"zone": "kaweezle.com"}}
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: target
+		data:
+		  revision: to-replace
+		  zone: to-replace
+		  untouched: untouched
+		`))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    name: source
+		    fieldPath: data.values\.yaml.!!yaml.common.missing.revision
+		  fallback:
+		    name: source
+		    fieldPath: data.values\.yaml.!!yaml.common.revision
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.revision
+		- source:
+		    name: source
+		    fieldPath: data.config\.json.!!json.common.region
+		  default: europe
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.zone
+		- source:
+		    name: source
+		    fieldPath: data.values\.yaml.!!yaml.missing
+		  optional: true
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.untouched
+		`)), &replacements))
+
+	results := framework.Results{}
+	nodes, err = extendedFilter{Replacements: replacements, results: &results}.Filter(nodes)
+	require.NoError(err)
+	data := nodes[1].Field("data").Value
+	require.Equal("main", data.Field("revision").Value.YNode().Value)
+	require.Equal("europe", data.Field("zone").Value.YNode().Value)
+	require.Equal("untouched", data.Field("untouched").Value.YNode().Value)
+	require.Len(results, 1, "the optional replacement should be reported as skipped")
+
+	replacements[2].Optional = false
+	_, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.Error(err, "missing extended sources should fail when not optional")
+}
+
+func (s *ExtenderTestSuite) TestReplacementLiteralSources() {
+	require := s.Require()
+	s.T().Setenv("TARGET_REVISION", "feature/ci")
+	s.T().Setenv("SECRET_TOKEN", "secret")
+
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(`
+		apiVersion: argoproj.io/v1alpha1
+		kind: Application
+		metadata:
+		  name: app
+		spec:
+		  source:
+		    targetRevision: main
+		    helm:
+		      parameters: []
+		`))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- envVar: TARGET_REVISION
+		  targets:
+		    - select:
+		        kind: Application
+		      fieldPaths:
+		        - spec.source.targetRevision
+		- value:
+		    - name: replicas
+		      value: "2"
+		  targets:
+		    - select:
+		        kind: Application
+		      fieldPaths:
+		        - spec.source.helm.parameters
+		- envVar: UNSET_VARIABLE
+		  optional: true
+		  targets:
+		    - select:
+		        kind: Application
+		      fieldPaths:
+		        - spec.source.targetRevision
+		`)), &replacements))
+
+	filter := extendedFilter{Replacements: replacements, allowedEnvVars: []string{"TARGET_REVISION", "UNSET_VARIABLE"}}
+	nodes, err = filter.Filter(nodes)
+	require.NoError(err)
+	revision, err := nodes[0].Pipe(yaml.Lookup("spec", "source", "targetRevision"))
+	require.NoError(err)
+	require.Equal("feature/ci", yaml.GetValue(revision))
+	parameter, err := nodes[0].Pipe(yaml.Lookup("spec", "source", "helm", "parameters", "[name=replicas]", "value"))
+	require.NoError(err)
+	require.Equal("2", yaml.GetValue(parameter))
+
+	replacements[0].EnvVar = "SECRET_TOKEN"
+	_, err = filter.Filter(nodes)
+	require.Error(err, "environment variables should be allowed")
+	require.Contains(err.Error(), "SECRET_TOKEN is not allowed")
+
+	replacements[0].Source = &SourceSelector{SourceSelector: types.SourceSelector{ResId: resid.ResId{Name: "app"}}}
+	_, err = filter.Filter(nodes)
+	require.Error(err, "only one source should be specified")
+}
+
+func (s *ExtenderTestSuite) TestApr1Crypt() {
+	require := s.Require()
+	// Values generated with openssl passwd -apr1
+	require.Equal("$apr1$sQ3kd9Gf$7ySg6aYkrarf7UwXGZOCo/", apr1Crypt([]byte("p@ssw0rd with a fairly long value"), []byte("sQ3kd9Gf")))
+	require.Equal("$apr1$abcdefgh$G8IsPsylW5ROvIKsQMRG61", apr1Crypt([]byte("a"), []byte("abcdefgh")))
+}
+
+func (s *ExtenderTestSuite) TestReplacementTransforms() {
+	require := s.Require()
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(`
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: credentials
+		data:
+		  password: IFNlY3JldCA=
+		  url: https://git.example.com/Org/Repo.git?ref=v1.2.3
+		---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: target
+		data:
+		  auth: to-replace
+		  checksum: to-replace
+		  version: to-replace
+		  query: to-replace
+		  quoted: to-replace
+		`))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    name: credentials
+		    fieldPath: data.password
+		    transforms:
+		      - type: base64decode
+		      - type: trim
+		      - type: htpasswd
+		        algorithm: bcrypt
+		        cost: 4
+		        user: admin
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.auth
+		- source:
+		    name: credentials
+		    fieldPath: data.password
+		    transforms:
+		      - type: base64decode
+		      - type: trim
+		      - type: lower
+		      - type: sha256
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.checksum
+		- source:
+		    name: credentials
+		    fieldPath: data.url
+		    transforms:
+		      - type: split
+		        delimiter: "?"
+		        index: 1
+		      - type: regex
+		        regex: ref=v(.*)
+		      - type: upper
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.version
+		- source:
+		    name: credentials
+		    fieldPath: data.url
+		    transforms:
+		      - type: urlencode
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.query
+		- source:
+		    name: credentials
+		    fieldPath: data.url
+		    transforms:
+		      - type: regex
+		        regex: ([a-z]+)://([^/]+)
+		        group: 2
+		      - type: jsonquote
+		  targets:
+		    - select:
+		        name: target
+		      fieldPaths:
+		        - data.quoted
+		`)), &replacements))
+
+	nodes, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.NoError(err)
+	data := nodes[1].Field("data").Value
+
+	auth := data.Field("auth").Value.YNode().Value
+	require.True(strings.HasPrefix(auth, "admin:$2a$04$"), "auth should be a bcrypt htpasswd entry: %s", auth)
+	require.NoError(bcrypt.CompareHashAndPassword([]byte(strings.TrimPrefix(auth, "admin:")), []byte("Secret")))
+
+	sum := sha256.Sum256([]byte("secret"))
+	require.Equal(hex.EncodeToString(sum[:]), data.Field("checksum").Value.YNode().Value)
+	require.Equal("1.2.3", data.Field("version").Value.YNode().Value)
+	require.Equal("https%3A%2F%2Fgit.example.com%2FOrg%2FRepo.git%3Fref%3Dv1.2.3", data.Field("query").Value.YNode().Value)
+	require.Equal(`"git.example.com"`, data.Field("quoted").Value.YNode().Value)
+
+	replacements[0].Source.Transforms = []*Transform{{Type: "unknown"}}
+	_, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.Error(err, "unknown transforms should fail")
+}
+
+func (s *ExtenderTestSuite) TestDeterministicHashes() {
+	require := s.Require()
+	const target = "Secret.v1.[noGrp]/argocd-secret.[noNs]:stringData.admin\\.password"
+	hash, err := bcryptHash("password", 4, "seed", target)
+	require.NoError(err)
+	require.NoError(bcrypt.CompareHashAndPassword([]byte(hash), []byte("password")))
+	again, err := bcryptHash("password", 4, "seed", target)
+	require.NoError(err)
+	require.Equal(hash, again, "seeded hashes should be stable")
+	other, err := bcryptHash("password", 4, "other seed", target)
+	require.NoError(err)
+	require.NotEqual(hash, other, "the salt should depend on the seed")
+	otherTarget, err := bcryptHash("password", 4, "seed", "other")
+	require.NoError(err)
+	require.NotEqual(hash[:29], otherTarget[:29], "the salt should depend on the target")
+	otherPassword, err := bcryptHash("other", 4, "seed", target)
+	require.NoError(err)
+	require.Equal(hash[:29], otherPassword[:29], "the salt should not depend on the password")
+	_, err = bcryptHash(strings.Repeat("a", 73), 4, "seed", target)
+	require.ErrorIs(err, bcrypt.ErrPasswordTooLong, "seeded hashes should reject long passwords")
+
+	entry, err := htpasswdTransform(&Transform{User: "admin", Seed: "seed"}, "password", target)
+	require.NoError(err)
+	again, err = htpasswdTransform(&Transform{User: "admin", Seed: "seed"}, "password", target)
+	require.NoError(err)
+	require.Equal(entry, again, "seeded htpasswd entries should be stable")
+	require.True(apr1Verify(strings.TrimPrefix(entry, "admin:"), "password"))
+	require.False(apr1Verify(strings.TrimPrefix(entry, "admin:"), "other"))
+	otherEntry, err := htpasswdTransform(&Transform{User: "admin", Seed: "seed"}, "other", target)
+	require.NoError(err)
+	require.Equal(entry[:20], otherEntry[:20], "the apr1 salt should not depend on the password")
+}
+
+func (s *ExtenderTestSuite) TestReplacementSeededHashes() {
+	require := s.Require()
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: credentials
+		data:
+		  password: secret
+		---
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: first
+		stringData:
+		  password: ""
+		---
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: second
+		stringData:
+		  password: ""
+		`))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    kind: ConfigMap
+		    name: credentials
+		    fieldPath: data.password
+		    transforms:
+		      - type: bcrypt
+		        cost: 4
+		        seed: my-seed
+		  targets:
+		    - select:
+		        kind: Secret
+		      fieldPaths:
+		        - stringData.password
+		`)), &replacements))
+
+	hashes := func() []string {
+		result, err := extendedFilter{Replacements: replacements}.Filter(nodes)
+		require.NoError(err)
+		return []string{
+			result[1].Field("stringData").Value.Field("password").Value.YNode().Value,
+			result[2].Field("stringData").Value.Field("password").Value.YNode().Value,
+		}
+	}
+	first := hashes()
+	for _, hash := range first {
+		require.NoError(bcrypt.CompareHashAndPassword([]byte(hash), []byte("secret")))
+	}
+	require.NotEqual(first[0][:29], first[1][:29], "each target should have its own salt")
+	require.Equal(first, hashes(), "seeded hashes should be stable")
+
+	replacements[0].Source.Transforms = []*Transform{{Type: "bcrypt", Seed: "my-seed"}, {Type: "base64encode"}}
+	_, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.Error(err, "seed should only be allowed on the last transform")
+	replacements[0].Source.Transforms = []*Transform{{Type: "sha256", Seed: "my-seed"}}
+	_, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.Error(err, "seed should only be allowed on hash transforms")
+}
+
+func (s *ExtenderTestSuite) TestReplacementKeepExistingHash() {
+	require := s.Require()
+	existing, err := bcrypt.GenerateFromPassword([]byte("password"), 4)
+	require.NoError(err)
+	apr1Entry := "admin:" + apr1Crypt([]byte("password"), []byte("abcdefgh"))
+
+	nodes, err := (&kio.ByteReader{OmitReaderAnnotations: true, Reader: bytes.NewBufferString(dedent.Dedent(fmt.Sprintf(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: credentials
+		data:
+		  password: password
+		---
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: argocd-secret
+		stringData:
+		  admin.password: %s
+		  other.password: %s
+		  htpasswd: %s
+		data:
+		  admin.password: %s
+		`, existing, existing, apr1Entry, base64.StdEncoding.EncodeToString(existing))))}).Read()
+	require.NoError(err)
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    name: credentials
+		    fieldPath: data.password
+		    transforms:
+		      - type: bcrypt
+		        cost: 4
+		        keepExisting: true
+		  targets:
+		    - select:
+		        name: argocd-secret
+		      fieldPaths:
+		        - stringData.admin\.password
+		        - data.admin\.password.!!base64
+		- source:
+		    name: credentials
+		    fieldPath: data.password
+		    transforms:
+		      - type: upper
+		      - type: bcrypt
+		        cost: 4
+		        keepExisting: true
+		  targets:
+		    - select:
+		        name: argocd-secret
+		      fieldPaths:
+		        - stringData.other\.password
+		- source:
+		    name: credentials
+		    fieldPath: data.password
+		    transforms:
+		      - type: htpasswd
+		        user: admin
+		        keepExisting: true
+		  targets:
+		    - select:
+		        name: argocd-secret
+		      fieldPaths:
+		        - stringData.htpasswd
+		`)), &replacements))
+
+	nodes, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.NoError(err)
+	stringData := nodes[1].Field("stringData").Value
+	require.Equal(string(existing), stringData.Field("admin.password").Value.YNode().Value, "verified hash should be kept")
+	require.Equal(base64.StdEncoding.EncodeToString(existing), nodes[1].Field("data").Value.Field("admin.password").Value.YNode().Value, "verified embedded hash should be kept")
+	require.Equal(apr1Entry, stringData.Field("htpasswd").Value.YNode().Value, "verified htpasswd entry should be kept")
+	other := stringData.Field("other.password").Value.YNode().Value
+	require.NotEqual(string(existing), other, "hash of another value should be replaced")
+	require.NoError(bcrypt.CompareHashAndPassword([]byte(other), []byte("PASSWORD")))
+
+	replacements[0].Source.Transforms = []*Transform{{Type: BcryptTransform, KeepExisting: true}, {Type: Base64EncodeTransform}}
+	_, err = extendedFilter{Replacements: replacements}.Filter(nodes)
+	require.Error(err, "keepExisting should only be allowed on the last transform")
+}
+
+// pluginHelpers returns plugin helpers with a loader rooted at dir.
+func pluginHelpers(require *require.Assertions, dir string) *resmap.PluginHelpers {
+	ldr, err := loader.NewLoader(loader.RestrictionNone, dir, filesys.MakeFsOnDisk())
+	require.NoError(err)
+	depProvider := provider.NewDepProvider()
+	return resmap.NewPluginHelpers(ldr, depProvider.GetFieldValidator(), resmap.NewFactory(depProvider.GetResourceFactory()), types.DisabledPluginConfig())
+}
+
+// newResMap returns a resource map made of the YAML documents, that are
+// dedented.
+func newResMap(require *require.Assertions, documents ...string) resmap.ResMap {
+	content := []string{}
+	for _, document := range documents {
+		content = append(content, dedent.Dedent(document))
+	}
+	m, err := resmap.NewFactory(provider.NewDepProvider().GetResourceFactory()).NewResMapFromBytes([]byte(strings.Join(content, "\n---\n")))
+	require.NoError(err)
+	return m
+}
+
+// Age key pair used to test sops encryption.
+const (
+	testAgeIdentity  = "AGE-SECRET-KEY-1YLNKRGF26ZA4YGL35MANYHSC0T2MHEY4FEFVGWS2KQVWCJ58LCPQGYRT4F"
+	testAgeRecipient = "age1an0tph3q3gfk8yk5nnchlp7a49vmk25jfrwnlm2wwxy0gef9t9kqakg9hj"
+)
+
+func (s *ExtenderTestSuite) TestSopsExtender() {
+	require := s.Require()
+	s.T().Setenv("SOPS_AGE_KEY", testAgeIdentity)
+	m := newResMap(require, `
+		apiVersion: v1
+		kind: Secret
+		metadata:
+		  name: app-secret
+		stringData:
+		  username: admin
+		  password: secret1
+		`)
+	transformer := NewSopsEncryptTransformerPlugin()
+	require.NoError(transformer.Config(nil, []byte("targets:\n  - kind: Secret\nage:\n  - "+testAgeRecipient+"\nencryptedRegex: ^(data|stringData)$\n")))
+	require.NoError(transformer.Transform(m))
+	encrypted := &m.Resources()[0].RNode
+	_, err := removeInternalAnnotations(encrypted)
+	require.NoError(err)
+	content, err := encrypted.String()
+	require.NoError(err)
+
+	embedded := yaml.NewMapRNode(&map[string]string{"secrets.yaml": content})
+	configMap, err := yaml.Parse(dedent.Dedent(`
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+		  name: secrets
+		`))
+	require.NoError(err)
+	require.NoError(configMap.PipeE(yaml.SetField("data", embedded)))
+	encrypted.SetAnnotations(map[string]string{"internal.config.kubernetes.io/path": "secret.yaml"})
+
+	replacements := []Replacement{}
+	require.NoError(yaml.Unmarshal([]byte(dedent.Dedent(`
+		- source:
+		    kind: ConfigMap
+		    fieldPath: data.secrets\.yaml.!!sops.stringData.username
+		    transforms:
+		      - type: upper
+		  targets:
+		    - select:
+		        kind: ConfigMap
+		      fieldPaths:
+		        - data.secrets\.yaml.!!sops.stringData.password
+		    - select:
+		        kind: Secret
+		      fieldPaths:
+		        - "!!sops.stringData.password"
+		`)), &replacements))
+
+	nodes, err := (extendedFilter{Replacements: replacements}).Filter([]*yaml.RNode{configMap, encrypted})
+	require.NoError(err)
+
+	decrypt := func(content string) *yaml.RNode {
+		decrypted, err := Decrypt([]byte(content), formats.Yaml, "secrets.yaml", false)
+		require.NoError(err)
+		require.Len(decrypted, 1)
+		return decrypted[0]
+	}
+	lookup := func(node *yaml.RNode, path ...string) string {
+		field, err := node.Pipe(yaml.Lookup(path...))
+		require.NoError(err)
+		require.NotNil(field)
+		return yaml.GetValue(field)
+	}
+
+	modified := lookup(nodes[0], "data", "secrets.yaml")
+	require.NotContains(modified, "ADMIN", "no plaintext should be left")
+	require.Equal("ADMIN", lookup(decrypt(modified), "stringData", "password"))
+	require.Equal("admin", lookup(decrypt(modified), "stringData", "username"))
+	original := decrypt(content)
+	require.Equal("secret1", lookup(original, "stringData", "password"))
+	modifiedNode, err := yaml.Parse(modified)
+	require.NoError(err)
+	require.Equal(lookup(encrypted, "sops", "age", "0", "enc"), lookup(modifiedNode, "sops", "age", "0", "enc"), "the data key is kept")
+	require.Equal("^(data|stringData)$", lookup(modifiedNode, "sops", "encrypted_regex"))
+
+	secret := nodes[1]
+	require.Equal("secret.yaml", secret.GetAnnotations()["internal.config.kubernetes.io/path"])
+	_, err = removeInternalAnnotations(secret)
+	require.NoError(err)
+	secretContent, err := secret.String()
+	require.NoError(err)
+	require.Equal("ADMIN", lookup(decrypt(secretContent), "stringData", "password"))
+
+	// Tampered content is rejected
+	tampered := strings.Replace(content, "name: app-secret", "name: other-secret", 1)
+	_, err = (&ExtendedPath{ResourcePath: []string{"data"}, ExtendedSegments: &[]*ExtendedSegment{{Encoding: "sops", Path: []string{"stringData", "username"}}}}).Get(
+		yaml.NewMapRNode(&map[string]string{"data": tampered}))
+	require.Error(err)
+	require.Contains(err.Error(), "MAC mismatch")
+}
+
 func TestExtender(t *testing.T) {
 	suite.Run(t, new(ExtenderTestSuite))
 }
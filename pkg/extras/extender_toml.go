@@ -0,0 +1,1077 @@
+package extras
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+///////
+// TOML
+///////
+
+// tomlEntry is a table header or a key/value expression of a TOML document.
+//
+// path is the absolute path of the table or key. Instances of arrays of tables
+// are identified by their index in the path. For instance, the address key of
+// the second [[entryPoints]] table has the path ["entryPoints", "1",
+// "address"].
+type tomlEntry struct {
+	path       []string
+	header     bool
+	start      int // offset of the beginning of the line
+	end        int // offset of the end of the line, newline included
+	valueStart int // offset of the raw value for key/values
+	valueEnd   int
+}
+
+// tomlDocument contains the entries of a TOML document in order of
+// appearance.
+type tomlDocument []*tomlEntry
+
+// samePath returns true if a and b are equal.
+func samePath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPathPrefix returns true if prefix is a strict prefix of path.
+func hasPathPrefix(path, prefix []string) bool {
+	return len(path) > len(prefix) && samePath(path[:len(prefix)], prefix)
+}
+
+// find returns the entry with the given path, or nil.
+func (d tomlDocument) find(path []string) *tomlEntry {
+	for _, entry := range d {
+		if samePath(entry.path, path) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// findValuePrefix returns the key/value entry whose path is a prefix of path,
+// or nil. It is used to modify values inside inline tables and arrays.
+func (d tomlDocument) findValuePrefix(path []string) *tomlEntry {
+	for _, entry := range d {
+		if !entry.header && hasPathPrefix(path, entry.path) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// isTable returns true if path is a table, i.e. there is a header for path or
+// entries under path.
+func (d tomlDocument) isTable(path []string) bool {
+	for _, entry := range d {
+		if (entry.header && samePath(entry.path, path)) || hasPathPrefix(entry.path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableSpan returns the offsets of the text of the table with a header at
+// path, header excluded. The text spans the key/values and sub tables of the
+// table, with the comments between them. It returns false if there is no
+// header for path.
+func (d tomlDocument) tableSpan(path []string) (int, int, bool) {
+	for i, entry := range d {
+		if !entry.header || !samePath(entry.path, path) {
+			continue
+		}
+		start, end := entry.end, entry.end
+		for _, next := range d[i+1:] {
+			if hasPathPrefix(next.path, path) {
+				end = next.end
+			} else if next.header {
+				break
+			}
+		}
+		return start, end, true
+	}
+	return 0, 0, false
+}
+
+// insertionPoint returns the longest prefix of path having a table header
+// (or the root table), the offset where to insert new keys in this table and
+// the indentation of the last key of the table.
+func (d tomlDocument) insertionPoint(text []byte, path []string) ([]string, int, string) {
+	for l := len(path) - 1; l >= 0; l-- {
+		prefix := path[:l]
+		var last *tomlEntry
+		inTable := l == 0
+		for _, entry := range d {
+			if entry.header {
+				if inTable && l == 0 {
+					break
+				}
+				inTable = samePath(entry.path, prefix)
+				if inTable {
+					last = entry
+				}
+				continue
+			}
+			if inTable {
+				last = entry
+			}
+		}
+		switch {
+		case last == nil && l == 0:
+			return prefix, 0, ""
+		case last == nil:
+			continue
+		case last.header:
+			return prefix, last.end, ""
+		}
+		indent := text[last.start:skipTomlWhitespace(text, last.start)]
+		return prefix, last.end, string(indent)
+	}
+	return []string{}, 0, ""
+}
+
+// tomlBareKey matches the keys that don't need quoting.
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlDate matches the date part of a TOML date time.
+var tomlDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// skipTomlWhitespace returns the offset of the first non space character after
+// i.
+func skipTomlWhitespace(text []byte, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// skipTomlComment returns the offset of the end of line if a comment starts at
+// i.
+func skipTomlComment(text []byte, i int) int {
+	if i < len(text) && text[i] == '#' {
+		for i < len(text) && text[i] != '\n' {
+			i++
+		}
+	}
+	return i
+}
+
+// skipTomlBlank skips whitespace, comments and new lines.
+func skipTomlBlank(text []byte, i int) int {
+	for {
+		j := skipTomlComment(text, skipTomlWhitespace(text, i))
+		if j < len(text) && (text[j] == '\n' || text[j] == '\r') {
+			j++
+		}
+		if j == i {
+			return i
+		}
+		i = j
+	}
+}
+
+// scanTomlString returns the end offset of the string starting at i.
+func scanTomlString(text []byte, i int) (int, error) {
+	quote := text[i]
+	if bytes.HasPrefix(text[i:], []byte{quote, quote, quote}) {
+		delimiter := []byte{quote, quote, quote}
+		j := i + 3
+		for j < len(text) {
+			if quote == '"' && text[j] == '\\' {
+				j += 2
+				continue
+			}
+			if bytes.HasPrefix(text[j:], delimiter) {
+				j += 3
+				// up to two additional quotes can be part of the content
+				for k := 0; k < 2 && j < len(text) && text[j] == quote; k++ {
+					j++
+				}
+				return j, nil
+			}
+			j++
+		}
+		return 0, fmt.Errorf("unterminated multi-line string")
+	}
+	for j := i + 1; j < len(text) && text[j] != '\n'; j++ {
+		if quote == '"' && text[j] == '\\' {
+			j++
+			continue
+		}
+		if text[j] == quote {
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+// scanTomlKey parses the possibly dotted key starting at i. It returns the key
+// segments and the offset after the key.
+func scanTomlKey(text []byte, i int) ([]string, int, error) {
+	key := []string{}
+	for {
+		i = skipTomlWhitespace(text, i)
+		if i >= len(text) {
+			return nil, i, fmt.Errorf("unexpected end of document in key")
+		}
+		switch text[i] {
+		case '"', '\'':
+			end, err := scanTomlString(text, i)
+			if err != nil {
+				return nil, i, err
+			}
+			segment, err := decodeTomlString(string(text[i:end]))
+			if err != nil {
+				return nil, i, err
+			}
+			key = append(key, segment)
+			i = end
+		default:
+			start := i
+			for i < len(text) && (tomlBareKey.Match(text[i : i+1])) {
+				i++
+			}
+			if start == i {
+				return nil, i, fmt.Errorf("invalid character %q in key", text[i])
+			}
+			key = append(key, string(text[start:i]))
+		}
+		i = skipTomlWhitespace(text, i)
+		if i >= len(text) || text[i] != '.' {
+			return key, i, nil
+		}
+		i++
+	}
+}
+
+// scanTomlValue returns the end offset of the value starting at i.
+func scanTomlValue(text []byte, i int) (int, error) {
+	if i >= len(text) {
+		return 0, fmt.Errorf("missing value")
+	}
+	switch text[i] {
+	case '"', '\'':
+		return scanTomlString(text, i)
+	case '[':
+		i = skipTomlBlank(text, i+1)
+		for i < len(text) && text[i] != ']' {
+			end, err := scanTomlValue(text, i)
+			if err != nil {
+				return 0, err
+			}
+			i = skipTomlBlank(text, end)
+			if i < len(text) && text[i] == ',' {
+				i = skipTomlBlank(text, i+1)
+			}
+		}
+		if i >= len(text) {
+			return 0, fmt.Errorf("unterminated array")
+		}
+		return i + 1, nil
+	case '{':
+		i = skipTomlWhitespace(text, i+1)
+		for i < len(text) && text[i] != '}' {
+			_, end, err := scanTomlKey(text, i)
+			if err != nil {
+				return 0, err
+			}
+			i = skipTomlWhitespace(text, end)
+			if i >= len(text) || text[i] != '=' {
+				return 0, fmt.Errorf("expected = in inline table")
+			}
+			end, err = scanTomlValue(text, skipTomlWhitespace(text, i+1))
+			if err != nil {
+				return 0, err
+			}
+			i = skipTomlWhitespace(text, end)
+			if i < len(text) && text[i] == ',' {
+				i = skipTomlWhitespace(text, i+1)
+			}
+		}
+		if i >= len(text) {
+			return 0, fmt.Errorf("unterminated inline table")
+		}
+		return i + 1, nil
+	}
+	start := i
+	for i < len(text) && !bytes.ContainsAny(text[i:i+1], " \t\r\n,]}#") {
+		i++
+	}
+	// date time with a space separator
+	if tomlDate.Match(text[start:i]) && i+1 < len(text) && text[i] == ' ' && text[i+1] >= '0' && text[i+1] <= '9' {
+		i++
+		for i < len(text) && !bytes.ContainsAny(text[i:i+1], " \t\r\n,]}#") {
+			i++
+		}
+	}
+	if start == i {
+		return 0, fmt.Errorf("missing value")
+	}
+	return i, nil
+}
+
+// parseTomlDocument returns the headers and key/values contained in text.
+func parseTomlDocument(text []byte) (tomlDocument, error) {
+	doc := tomlDocument{}
+	table := []string{}
+	lastIndex := map[string]int{}
+	counts := map[string]int{}
+
+	// absolute inserts the current index of arrays of tables in path.
+	absolute := func(path []string) []string {
+		result := []string{}
+		for _, p := range path {
+			result = append(result, p)
+			if index, ok := lastIndex[strings.Join(result, "\x00")]; ok {
+				result = append(result, strconv.Itoa(index))
+			}
+		}
+		return result
+	}
+
+	for i := 0; i < len(text); {
+		start := i
+		i = skipTomlComment(text, skipTomlWhitespace(text, i))
+		if i < len(text) && text[i] != '\n' && text[i] != '\r' {
+			entry := &tomlEntry{start: start}
+			if text[i] == '[' {
+				array := i+1 < len(text) && text[i+1] == '['
+				i++
+				if array {
+					i++
+				}
+				key, end, err := scanTomlKey(text, i)
+				if err != nil {
+					return nil, err
+				}
+				i = end
+				closing := "]"
+				if array {
+					closing = "]]"
+				}
+				if !bytes.HasPrefix(text[i:], []byte(closing)) {
+					return nil, fmt.Errorf("expected %s after table %s", closing, strings.Join(key, "."))
+				}
+				i += len(closing)
+				if array {
+					base := append(absolute(key[:len(key)-1]), key[len(key)-1])
+					id := strings.Join(base, "\x00")
+					lastIndex[id] = counts[id]
+					counts[id]++
+					table = append(base, strconv.Itoa(lastIndex[id]))
+				} else {
+					table = absolute(key)
+				}
+				entry.path = table
+				entry.header = true
+			} else {
+				key, end, err := scanTomlKey(text, i)
+				if err != nil {
+					return nil, err
+				}
+				i = skipTomlWhitespace(text, end)
+				if i >= len(text) || text[i] != '=' {
+					return nil, fmt.Errorf("expected = after key %s", strings.Join(key, "."))
+				}
+				entry.valueStart = skipTomlWhitespace(text, i+1)
+				entry.valueEnd, err = scanTomlValue(text, entry.valueStart)
+				if err != nil {
+					return nil, errors.WrapPrefixf(err, "while reading value of key %s", strings.Join(key, "."))
+				}
+				i = entry.valueEnd
+				entry.path = append(append([]string{}, table...), key...)
+			}
+			i = skipTomlComment(text, skipTomlWhitespace(text, i))
+			doc = append(doc, entry)
+		}
+		for i < len(text) && text[i] != '\n' {
+			i++
+		}
+		if i < len(text) {
+			i++
+		}
+		if len(doc) > 0 && doc[len(doc)-1].start == start {
+			doc[len(doc)-1].end = i
+		}
+	}
+	return doc, nil
+}
+
+// decodeTomlString returns the content of the TOML string raw.
+func decodeTomlString(raw string) (string, error) {
+	m := map[string]interface{}{}
+	if err := toml.Unmarshal([]byte("v = "+raw), &m); err != nil {
+		return "", errors.WrapPrefixf(err, "while decoding string %s", raw)
+	}
+	s, ok := m["v"].(string)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", raw)
+	}
+	return s, nil
+}
+
+// isTomlLiteral returns true if value is a single valid non string TOML value,
+// like a number, a boolean or a date. Values defining other keys, like
+// "1\nother = 2", are not literals.
+func isTomlLiteral(value string) bool {
+	m := map[string]interface{}{}
+	if err := toml.Unmarshal([]byte("v = "+value), &m); err != nil {
+		return false
+	}
+	v, found := m["v"]
+	if !found || len(m) != 1 {
+		return false
+	}
+	_, isString := v.(string)
+	return !isString
+}
+
+// quoteTomlString returns value as a TOML basic string.
+func quoteTomlString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// encodeTomlString returns value as a TOML string using the same style as
+// original when possible.
+func encodeTomlString(value string, original string) string {
+	switch {
+	case strings.HasPrefix(original, "'''") && !strings.Contains(value, "'''"):
+		if strings.HasPrefix(original, "'''\n") {
+			return "'''\n" + value + "'''"
+		}
+		return "'''" + value + "'''"
+	case strings.HasPrefix(original, `"""`):
+		quoted := quoteTomlString(value)
+		quoted = strings.ReplaceAll(quoted[1:len(quoted)-1], `\n`, "\n")
+		quoted = strings.ReplaceAll(quoted, `"""`, `""\"`)
+		if strings.HasPrefix(original, "\"\"\"\n") {
+			return "\"\"\"\n" + quoted + `"""`
+		}
+		return `"""` + quoted + `"""`
+	case strings.HasPrefix(original, "'") && !strings.ContainsAny(value, "'\n\r"):
+		return "'" + value + "'"
+	}
+	return quoteTomlString(value)
+}
+
+// encodeTomlKey returns key quoted if needed.
+func encodeTomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return quoteTomlString(key)
+}
+
+// encodeTomlInline returns the inline TOML representation of node.
+func encodeTomlInline(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case yaml.NodeTagInt, yaml.NodeTagFloat, yaml.NodeTagBool, "!!timestamp":
+			if isTomlLiteral(node.Value) {
+				return node.Value, nil
+			}
+		case yaml.NodeTagNull:
+			return "", fmt.Errorf("null values are not supported by toml")
+		}
+		return quoteTomlString(node.Value), nil
+	case yaml.SequenceNode:
+		items := []string{}
+		for _, item := range node.Content {
+			s, err := encodeTomlInline(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case yaml.MappingNode:
+		items := []string{}
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			s, err := encodeTomlInline(node.Content[i+1])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, encodeTomlKey(node.Content[i].Value)+" = "+s)
+		}
+		if len(items) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	case yaml.AliasNode:
+		return encodeTomlInline(node.Alias)
+	}
+	return "", fmt.Errorf("unsupported node kind %d", node.Kind)
+}
+
+// encodeTomlValue returns the raw TOML representation of value. original is
+// the raw value replaced, if any, and is used to keep the value type and
+// string style.
+func encodeTomlValue(value any, original string) (string, error) {
+	if node, ok := value.(*yaml.Node); ok && node.Kind != yaml.ScalarNode {
+		return encodeTomlInline(node)
+	}
+	s := string(getByteValue(value))
+	if original != "" {
+		if original[0] == '"' || original[0] == '\'' {
+			return encodeTomlString(s, original), nil
+		}
+		if isTomlLiteral(s) {
+			return s, nil
+		}
+		return quoteTomlString(s), nil
+	}
+	if node, ok := value.(*yaml.Node); ok {
+		return encodeTomlInline(node)
+	}
+	return quoteTomlString(s), nil
+}
+
+// tomlExtender is an [Extender] allowing the structured modification of a TOML
+// property.
+//
+// Modifications are made in place in the text, so that only the addressed
+// value changes.
+type tomlExtender struct {
+	text []byte
+}
+
+// SetPayload sets the internal state with the TOML source payload.
+func (e *tomlExtender) SetPayload(payload []byte) error {
+	m := map[string]interface{}{}
+	if err := toml.Unmarshal(payload, &m); err != nil {
+		return errors.WrapPrefixf(err, "while un-marshalling toml")
+	}
+	if _, err := parseTomlDocument(payload); err != nil {
+		return errors.WrapPrefixf(err, "while parsing toml")
+	}
+	e.text = payload
+	return nil
+}
+
+// getTOMLPayload returns the TOML representation of the specified node.
+//
+// The node must be a mapping node.
+func getTOMLPayload(node *yaml.RNode) ([]byte, error) {
+	m, err := node.Map()
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while encoding to map")
+	}
+	return toml.Marshal(m)
+}
+
+// GetPayload return the current payload as a TOML snippet.
+func (e *tomlExtender) GetPayload() ([]byte, error) {
+	return e.text, nil
+}
+
+// node returns the current payload as a RNode.
+func (e *tomlExtender) node() (*yaml.RNode, error) {
+	m := map[string]interface{}{}
+	if err := toml.Unmarshal(e.text, &m); err != nil {
+		return nil, errors.WrapPrefixf(err, "while un-marshalling toml")
+	}
+	node, err := yaml.FromMap(m)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while converting into yaml")
+	}
+	return node, nil
+}
+
+// walkTomlNode returns the node at the absolute path inside node, or nil if
+// it doesn't exist.
+func walkTomlNode(node *yaml.RNode, path []string) *yaml.RNode {
+	for _, segment := range path {
+		if node == nil {
+			return nil
+		}
+		switch node.YNode().Kind {
+		case yaml.MappingNode:
+			field := node.Field(segment)
+			if field == nil {
+				return nil
+			}
+			node = field.Value
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(segment)
+			elements := node.Content()
+			if err != nil || index < 0 || index >= len(elements) {
+				return nil
+			}
+			node = yaml.NewRNode(elements[index])
+		default:
+			return nil
+		}
+	}
+	return node
+}
+
+// resolve converts path into the absolute path of the document. [[table]]
+// segments are converted into table, and [key=value] or numeric segments
+// following an array are converted into the index of the matching element.
+func (e *tomlExtender) resolve(path []string) ([]string, error) {
+	node, err := e.node()
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, segment := range path {
+		if strings.HasPrefix(segment, "[[") && strings.HasSuffix(segment, "]]") {
+			segment = segment[2 : len(segment)-2]
+		}
+		if node != nil && node.YNode().Kind == yaml.SequenceNode {
+			elements := node.Content()
+			index, err := strconv.Atoi(segment)
+			if err != nil {
+				index = -1
+				if !yaml.IsListIndex(segment) {
+					return nil, fmt.Errorf("%s is not an index or a [key=value] selector", segment)
+				}
+				key, value, err := yaml.SplitIndexNameValue(segment)
+				if err != nil {
+					return nil, err
+				}
+				for i, element := range elements {
+					if v := walkTomlNode(yaml.NewRNode(element), []string{key}); v != nil && v.YNode().Value == value {
+						index = i
+						break
+					}
+				}
+				if index < 0 {
+					return nil, pathNotFoundError(fmt.Sprintf("no element matching %s", segment))
+				}
+			}
+			if index < 0 || index >= len(elements) {
+				return nil, pathNotFoundError(fmt.Sprintf("index %d out of range", index))
+			}
+			result = append(result, strconv.Itoa(index))
+			node = yaml.NewRNode(elements[index])
+			continue
+		}
+		if yaml.IsListIndex(segment) {
+			return nil, fmt.Errorf("%s used on a non array value", segment)
+		}
+		result = append(result, segment)
+		node = walkTomlNode(node, []string{segment})
+	}
+	return result, nil
+}
+
+// Get returns the TOML representation of the sub element at path. String
+// values are returned unquoted. For tables having a header, the source text of
+// the table is returned, with its ordering and comments.
+func (e *tomlExtender) Get(path []string) ([]byte, error) {
+	abs, err := e.resolve(path)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	doc, err := parseTomlDocument(e.text)
+	if err != nil {
+		return nil, err
+	}
+	if entry := doc.find(abs); entry != nil && !entry.header {
+		raw := string(e.text[entry.valueStart:entry.valueEnd])
+		if raw[0] == '"' || raw[0] == '\'' {
+			s, err := decodeTomlString(raw)
+			return []byte(s), err
+		}
+		return []byte(raw), nil
+	}
+	if start, end, ok := doc.tableSpan(abs); ok {
+		return append([]byte{}, e.text[start:end]...), nil
+	}
+
+	root, err := e.node()
+	if err != nil {
+		return nil, err
+	}
+	node := walkTomlNode(root, abs)
+	if node == nil {
+		return nil, pathNotFoundError(fmt.Sprintf("path %s not found", strings.Join(path, ".")))
+	}
+	switch node.YNode().Kind {
+	case yaml.ScalarNode:
+		return []byte(node.YNode().Value), nil
+	case yaml.MappingNode:
+		return getTOMLPayload(node)
+	}
+	s, err := encodeTomlInline(node.YNode())
+	return []byte(s), err
+}
+
+// GetNode returns the node at path. Key/values of the document keep their
+// type.
+func (e *tomlExtender) GetNode(path []string) (*yaml.RNode, error) {
+	abs, err := e.resolve(path)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	doc, err := parseTomlDocument(e.text)
+	if err != nil {
+		return nil, err
+	}
+	if entry := doc.find(abs); entry != nil && !entry.header {
+		raw := e.text[entry.valueStart:entry.valueEnd]
+		switch raw[0] {
+		case '"', '\'':
+			s, err := decodeTomlString(string(raw))
+			return yaml.NewStringRNode(s), err
+		case '[', '{':
+		default:
+			return yaml.NewScalarRNode(string(raw)), nil
+		}
+	}
+
+	root, err := e.node()
+	if err != nil {
+		return nil, err
+	}
+	node := walkTomlNode(root, abs)
+	if node == nil {
+		return nil, pathNotFoundError(fmt.Sprintf("path %s not found", strings.Join(path, ".")))
+	}
+	return node, nil
+}
+
+// replace replaces the text between start and end with value.
+func (e *tomlExtender) replace(start, end int, value string) {
+	text := make([]byte, 0, len(e.text)+len(value))
+	text = append(text, e.text[:start]...)
+	text = append(text, value...)
+	text = append(text, e.text[end:]...)
+	e.text = text
+}
+
+// tomlInlineElement is an element of an inline array or table.
+type tomlInlineElement struct {
+	key        []string // the index of the element for arrays
+	start      int      // offset of the key for tables, of the value for arrays
+	valueStart int
+	valueEnd   int
+}
+
+// scanTomlInline returns the elements of the inline array or table starting
+// at i.
+func scanTomlInline(text []byte, i int) ([]*tomlInlineElement, error) {
+	elements := []*tomlInlineElement{}
+	switch text[i] {
+	case '[':
+		i = skipTomlBlank(text, i+1)
+		for i < len(text) && text[i] != ']' {
+			end, err := scanTomlValue(text, i)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, &tomlInlineElement{key: []string{strconv.Itoa(len(elements))}, start: i, valueStart: i, valueEnd: end})
+			i = skipTomlBlank(text, end)
+			if i < len(text) && text[i] == ',' {
+				i = skipTomlBlank(text, i+1)
+			}
+		}
+	case '{':
+		i = skipTomlWhitespace(text, i+1)
+		for i < len(text) && text[i] != '}' {
+			key, end, err := scanTomlKey(text, i)
+			if err != nil {
+				return nil, err
+			}
+			element := &tomlInlineElement{key: key, start: i}
+			i = skipTomlWhitespace(text, end)
+			if i >= len(text) || text[i] != '=' {
+				return nil, fmt.Errorf("expected = in inline table")
+			}
+			element.valueStart = skipTomlWhitespace(text, i+1)
+			if element.valueEnd, err = scanTomlValue(text, element.valueStart); err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+			i = skipTomlWhitespace(text, element.valueEnd)
+			if i < len(text) && text[i] == ',' {
+				i = skipTomlWhitespace(text, i+1)
+			}
+		}
+	}
+	return elements, nil
+}
+
+// findInline looks for path inside the inline value starting at start and
+// ending at end. It returns the start and end of the innermost inline value
+// containing path, its elements and the index of the element at path, or -1
+// with the remaining path if the innermost value doesn't contain it.
+func (e *tomlExtender) findInline(start, end int, path []string) (int, int, []*tomlInlineElement, int, []string, error) {
+	for {
+		if e.text[start] != '[' && e.text[start] != '{' {
+			return 0, 0, nil, 0, nil, pathNotFoundError(fmt.Sprintf("path %s not found", strings.Join(path, ".")))
+		}
+		elements, err := scanTomlInline(e.text, start)
+		if err != nil {
+			return 0, 0, nil, 0, nil, err
+		}
+		found := -1
+		for i, element := range elements {
+			if samePath(element.key, path) || hasPathPrefix(path, element.key) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return start, end, elements, -1, path, nil
+		}
+		element := elements[found]
+		if len(element.key) == len(path) {
+			return start, end, elements, found, nil, nil
+		}
+		start, end, path = element.valueStart, element.valueEnd, path[len(element.key):]
+	}
+}
+
+// setInline modifies the value at path inside the inline value of entry. Only
+// the text of the addressed element changes. Missing keys of inline tables
+// are added at their end.
+func (e *tomlExtender) setInline(entry *tomlEntry, path []string, value any) error {
+	start, end, elements, index, missing, err := e.findInline(entry.valueStart, entry.valueEnd, path)
+	if err != nil {
+		return err
+	}
+	if index >= 0 {
+		element := elements[index]
+		raw, err := encodeTomlValue(value, string(e.text[element.valueStart:element.valueEnd]))
+		if err != nil {
+			return err
+		}
+		e.replace(element.valueStart, element.valueEnd, raw)
+		return nil
+	}
+
+	if e.text[start] == '[' {
+		return fmt.Errorf("invalid index %s", missing[0])
+	}
+	key := []string{}
+	for _, segment := range missing {
+		key = append(key, encodeTomlKey(segment))
+	}
+	raw, err := encodeTomlValue(value, "")
+	if err != nil {
+		return err
+	}
+	item := strings.Join(key, ".") + " = " + raw
+	if len(elements) == 0 {
+		e.replace(start+1, end-1, " "+item+" ")
+		return nil
+	}
+	last := elements[len(elements)-1]
+	e.replace(last.valueEnd, last.valueEnd, ", "+item)
+	return nil
+}
+
+// deleteInline removes the element at path inside the inline value of entry,
+// with its separator. The lines of elements of multi-line arrays are removed.
+// Nothing is done if the element doesn't exist.
+func (e *tomlExtender) deleteInline(entry *tomlEntry, path []string) error {
+	start, end, elements, index, _, err := e.findInline(entry.valueStart, entry.valueEnd, path)
+	if isPathNotFound(err) || index < 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	element := elements[index]
+	lineStart := bytes.LastIndexByte(e.text[:element.start], '\n') + 1
+	lineEnd := skipTomlWhitespace(e.text, element.valueEnd)
+	if lineEnd < len(e.text) && e.text[lineEnd] == ',' {
+		lineEnd = skipTomlWhitespace(e.text, lineEnd+1)
+	}
+	lineEnd = skipTomlComment(e.text, lineEnd)
+	if lineEnd < len(e.text) && e.text[lineEnd] == '\r' {
+		lineEnd++
+	}
+	alone := lineStart > start && skipTomlWhitespace(e.text, lineStart) == element.start &&
+		lineEnd < len(e.text) && e.text[lineEnd] == '\n'
+	switch {
+	case len(elements) == 1:
+		e.replace(start+1, end-1, "")
+	case alone:
+		// the element lines are removed with the separator and the comment
+		e.replace(lineStart, lineEnd+1, "")
+	case index < len(elements)-1:
+		e.replace(elements[index].start, elements[index+1].start, "")
+	default:
+		e.replace(elements[index-1].valueEnd, elements[index].valueEnd, "")
+	}
+	return nil
+}
+
+// tomlNewline returns the line ending used in text, "\r\n" or "\n".
+func tomlNewline(text []byte) string {
+	if i := bytes.IndexByte(text, '\n'); i > 0 && text[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// setAbsolute sets value at the absolute path abs.
+func (e *tomlExtender) setAbsolute(abs []string, value any) error {
+	doc, err := parseTomlDocument(e.text)
+	if err != nil {
+		return err
+	}
+
+	if entry := doc.find(abs); entry != nil && !entry.header {
+		raw, err := encodeTomlValue(value, string(e.text[entry.valueStart:entry.valueEnd]))
+		if err != nil {
+			return err
+		}
+		e.replace(entry.valueStart, entry.valueEnd, raw)
+		return nil
+	}
+
+	if entry := doc.findValuePrefix(abs); entry != nil {
+		return e.setInline(entry, abs[len(entry.path):], value)
+	}
+
+	if doc.isTable(abs) {
+		node, ok := value.(*yaml.Node)
+		if !ok || node.Kind != yaml.MappingNode {
+			return fmt.Errorf("only a mapping can be set in place of table %s", strings.Join(abs, "."))
+		}
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			child := append(append([]string{}, abs...), node.Content[i].Value)
+			if node.Content[i+1].Kind == yaml.SequenceNode && doc.isTable(append(child, "0")) {
+				return fmt.Errorf("replacing array of tables %s is not supported", strings.Join(child, "."))
+			}
+			if err := e.setAbsolute(child, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	table, offset, indent := doc.insertionPoint(e.text, abs)
+	key := []string{}
+	for _, segment := range abs[len(table):] {
+		if _, err := strconv.Atoi(segment); err == nil {
+			return fmt.Errorf("cannot create array element %s", strings.Join(abs, "."))
+		}
+		key = append(key, encodeTomlKey(segment))
+	}
+	raw, err := encodeTomlValue(value, "")
+	if err != nil {
+		return err
+	}
+	newline := tomlNewline(e.text)
+	line := indent + strings.Join(key, ".") + " = " + raw + newline
+	if offset > 0 && e.text[offset-1] != '\n' {
+		line = newline + line
+	}
+	e.replace(offset, offset, line)
+	return nil
+}
+
+// Set modifies the current payload at path with value.
+//
+// Only the text of the addressed value is modified. Missing keys are inserted
+// at the end of their table. When the path addresses a table and value is a
+// mapping, each key of the mapping is set in the table.
+func (e *tomlExtender) Set(path []string, value any) error {
+	abs, err := e.resolve(path)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while setting path %s", strings.Join(path, "."))
+	}
+	if err := e.setAbsolute(abs, value); err != nil {
+		return errors.WrapPrefixf(err, "while setting path %s", strings.Join(path, "."))
+	}
+	m := map[string]interface{}{}
+	if err := toml.Unmarshal(e.text, &m); err != nil {
+		return errors.WrapPrefixf(err, "toml is invalid after setting path %s", strings.Join(path, "."))
+	}
+	return nil
+}
+
+// Delete removes the key, table or array element at path.
+//
+// The lines of the removed keys and tables are removed from the text. Values
+// inside inline tables and arrays are removed with their separator.
+func (e *tomlExtender) Delete(path []string) error {
+	abs, err := e.resolve(path)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while deleting path %s", strings.Join(path, "."))
+	}
+	if len(abs) == 0 {
+		return fmt.Errorf("cannot delete empty path")
+	}
+	doc, err := parseTomlDocument(e.text)
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	for i := len(doc) - 1; i >= 0; i-- {
+		entry := doc[i]
+		if samePath(entry.path, abs) || hasPathPrefix(entry.path, abs) {
+			e.replace(entry.start, entry.end, "")
+			removed = true
+		}
+	}
+	if removed {
+		return nil
+	}
+
+	if entry := doc.findValuePrefix(abs); entry != nil {
+		return e.deleteInline(entry, abs[len(entry.path):])
+	}
+	return nil
+}
+
+// NewTomlExtender returns a newly created [Extender] for modifying properties
+// containing TOML.
+//
+// The modifications are made in place: the source ordering and the comments
+// are preserved and only the addressed values change. Elements of arrays of
+// tables can be selected with [key=value] or with their index:
+//
+//	!!toml.[[entryPoints]].[name=web].address
+//	!!toml.entryPoints.0.address
+func NewTomlExtender() Extender {
+	return &tomlExtender{}
+}
@@ -0,0 +1,480 @@
+package extras
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+//////////////
+// XML
+//////////////
+
+// xmlExtender is an [Extender] allowing the structured modification of XML
+// content.
+//
+// Internally, it uses an etree document. It preserves element ordering,
+// comments, processing instructions and namespace prefixes.
+type xmlExtender struct {
+	doc *etree.Document
+}
+
+// xmlSelection is the result of the lookup of a path in an XML document.
+//
+// It contains the matching elements and, if the path ends with an @attribute
+// segment, the name of the attribute.
+type xmlSelection struct {
+	elements []*etree.Element
+	attr     string
+}
+
+// SetPayload parses the XML payload and stores it internally.
+func (e *xmlExtender) SetPayload(payload []byte) error {
+	e.doc = etree.NewDocument()
+	e.doc.ReadSettings.PreserveCData = true
+	e.doc.WriteSettings.CanonicalText = true
+	e.doc.WriteSettings.CanonicalAttrVal = true
+	if err := e.doc.ReadFromBytes(payload); err != nil {
+		return errors.WrapPrefixf(err, "while reading xml")
+	}
+	return nil
+}
+
+// GetPayload returns the current document as XML.
+func (e *xmlExtender) GetPayload() ([]byte, error) {
+	return e.doc.WriteToBytes()
+}
+
+// xmlTagMatches returns true if the element e matches segment. If segment
+// contains a namespace prefix, the full tag is compared. Otherwise only the
+// local name is.
+func xmlTagMatches(e *etree.Element, segment string) bool {
+	if strings.Contains(segment, ":") {
+		return e.FullTag() == segment
+	}
+	return e.Tag == segment
+}
+
+// xmlChildren returns the child elements of parent matching segment.
+func xmlChildren(parent *etree.Element, segment string) []*etree.Element {
+	result := []*etree.Element{}
+	for _, c := range parent.ChildElements() {
+		if xmlTagMatches(c, segment) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// xmlPredicateMatches returns true if element has an attribute named key with
+// the given value or, if no such attribute exists, a child element named key
+// containing value.
+func xmlPredicateMatches(element *etree.Element, key, value string) bool {
+	key = strings.TrimPrefix(key, "@")
+	if a := element.SelectAttr(key); a != nil {
+		return a.Value == value
+	}
+	for _, c := range xmlChildren(element, key) {
+		if strings.TrimSpace(c.Text()) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// xmlIsWhitespace returns true if token is a whitespace only character data.
+func xmlIsWhitespace(token etree.Token) bool {
+	cd, ok := token.(*etree.CharData)
+	return ok && !cd.IsCData() && strings.TrimSpace(cd.Data) == ""
+}
+
+// xmlIndentation returns the indentation of element, i.e. the whitespace
+// located between the previous line break and the element start tag. It
+// returns false if the element is not preceded by a line break.
+func xmlIndentation(element *etree.Element) (string, bool) {
+	parent := element.Parent()
+	if parent == nil || element.Index() == 0 {
+		return "", false
+	}
+	if previous := parent.Child[element.Index()-1]; xmlIsWhitespace(previous) {
+		data := previous.(*etree.CharData).Data
+		if i := strings.LastIndex(data, "\n"); i >= 0 {
+			return data[i+1:], true
+		}
+	}
+	return "", false
+}
+
+// xmlIndentUnit guesses the indentation unit of the document by looking at
+// the first child of the root element. It defaults to two spaces.
+func xmlIndentUnit(doc *etree.Document) string {
+	root := doc.Root()
+	if root != nil {
+		rootIndent, _ := xmlIndentation(root)
+		for _, c := range root.ChildElements() {
+			if indent, ok := xmlIndentation(c); ok && len(indent) > len(rootIndent) {
+				return indent[len(rootIndent):]
+			}
+		}
+	}
+	return "  "
+}
+
+// addXmlChild appends child to parent. If the parent content is indented,
+// the child is inserted with the same indentation as its siblings.
+func (e *xmlExtender) addXmlChild(parent *etree.Element, child *etree.Element) {
+	unit := xmlIndentUnit(e.doc)
+	parentIndent, indented := xmlIndentation(parent)
+	childIndent := parentIndent + unit
+	for _, c := range parent.ChildElements() {
+		childIndent, indented = xmlIndentation(c)
+	}
+	if !indented {
+		parent.AddChild(child)
+		return
+	}
+
+	last := len(parent.Child) - 1
+	if last >= 0 && xmlIsWhitespace(parent.Child[last]) {
+		parent.InsertChildAt(last, etree.NewText("\n"+childIndent))
+		parent.InsertChildAt(last+1, child)
+	} else {
+		parent.AddChild(etree.NewText("\n" + childIndent))
+		parent.AddChild(child)
+		parent.AddChild(etree.NewText("\n" + parentIndent))
+	}
+	xmlIndentElement(child, childIndent, unit)
+}
+
+// xmlIndentElement indents the child elements of element. indent is the
+// indentation of element and unit the indentation added at each level.
+func xmlIndentElement(element *etree.Element, indent string, unit string) {
+	children := element.ChildElements()
+	if len(children) == 0 {
+		return
+	}
+	for _, c := range children {
+		element.InsertChildAt(c.Index(), etree.NewText("\n"+indent+unit))
+		xmlIndentElement(c, indent+unit, unit)
+	}
+	element.AddChild(etree.NewText("\n" + indent))
+}
+
+// lookup returns the elements and attribute addressed by path. The first
+// segment of path must match the root element. If create is true, missing
+// elements are created.
+//
+// Segments can be:
+//
+//   - an element tag, optionally with its namespace prefix (ns:tag).
+//   - a predicate [key=value] selecting the elements that have an attribute
+//     (or a child element) key equal to value.
+//   - a numeric index selecting one of the matching elements.
+//   - an attribute name prefixed by @. It must be the last segment.
+func (e *xmlExtender) lookup(path []string, create bool) (*xmlSelection, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("xml path cannot be empty")
+	}
+
+	root := e.doc.Root()
+	if root == nil || !xmlTagMatches(root, path[0]) {
+		return nil, pathNotFoundError(fmt.Sprintf("root element %s not found", path[0]))
+	}
+
+	selection := &xmlSelection{elements: []*etree.Element{root}}
+	parents := []*etree.Element{}
+	tag := path[0]
+
+	for i := 1; i < len(path); i++ {
+		segment := path[i]
+		switch {
+		case strings.HasPrefix(segment, "@"):
+			if i != len(path)-1 {
+				return nil, fmt.Errorf("attribute %s must be the last segment of path", segment)
+			}
+			selection.attr = segment[1:]
+		case strings.HasPrefix(segment, "[") && strings.HasSuffix(segment, "]"):
+			parts := strings.SplitN(segment[1:len(segment)-1], "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("bad predicate %s in xml path", segment)
+			}
+			matching := []*etree.Element{}
+			for _, element := range selection.elements {
+				if xmlPredicateMatches(element, parts[0], parts[1]) {
+					matching = append(matching, element)
+				}
+			}
+			if len(matching) == 0 && create && len(parents) > 0 {
+				element := etree.NewElement(tag)
+				element.CreateAttr(strings.TrimPrefix(parts[0], "@"), parts[1])
+				e.addXmlChild(parents[0], element)
+				matching = append(matching, element)
+			}
+			selection.elements = matching
+		default:
+			if index, err := strconv.Atoi(segment); err == nil {
+				if index < 0 || index >= len(selection.elements) {
+					return nil, pathNotFoundError(fmt.Sprintf("index %d out of range in xml path", index))
+				}
+				selection.elements = selection.elements[index : index+1]
+				continue
+			}
+			parents = selection.elements
+			tag = segment
+			matching := []*etree.Element{}
+			for _, element := range selection.elements {
+				children := xmlChildren(element, segment)
+				if len(children) == 0 && create {
+					child := etree.NewElement(segment)
+					e.addXmlChild(element, child)
+					children = append(children, child)
+				}
+				matching = append(matching, children...)
+			}
+			selection.elements = matching
+		}
+		if len(selection.elements) == 0 {
+			return nil, pathNotFoundError(fmt.Sprintf("nothing found at path %s", strings.Join(path[:i+1], ".")))
+		}
+	}
+	return selection, nil
+}
+
+// Get returns the value of the attribute or the element at path. If the
+// element contains other elements, its XML representation is returned.
+// Otherwise, its text is returned.
+func (e *xmlExtender) Get(path []string) ([]byte, error) {
+	selection, err := e.lookup(path, false)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	element := selection.elements[0]
+	if selection.attr != "" {
+		a := element.SelectAttr(selection.attr)
+		if a == nil {
+			return nil, pathNotFoundError(fmt.Sprintf("attribute %s not found at path %s", selection.attr, strings.Join(path, ".")))
+		}
+		return []byte(a.Value), nil
+	}
+
+	if len(element.ChildElements()) == 0 {
+		return []byte(element.Text()), nil
+	}
+
+	doc := etree.NewDocumentWithRoot(element.Copy())
+	doc.WriteSettings = e.doc.WriteSettings
+	return doc.WriteToBytes()
+}
+
+// xmlNode returns element as a node. Elements containing only text are
+// returned as scalars. Otherwise, the mapping has the same structure as the
+// one accepted by [setXmlContent]: attributes are prefixed with @, the text is
+// in #text and repeated child elements are sequences.
+func xmlNode(element *etree.Element) *yaml.RNode {
+	children := element.ChildElements()
+	if len(element.Attr) == 0 && len(children) == 0 {
+		return yaml.NewStringRNode(element.Text())
+	}
+	node := yaml.NewMapRNode(nil)
+	for _, a := range element.Attr {
+		node.YNode().Content = append(node.YNode().Content, yaml.NewStringRNode("@"+a.FullKey()).YNode(), yaml.NewStringRNode(a.Value).YNode())
+	}
+	if text := strings.TrimSpace(element.Text()); text != "" {
+		node.YNode().Content = append(node.YNode().Content, yaml.NewStringRNode("#text").YNode(), yaml.NewStringRNode(text).YNode())
+	}
+	tags := []string{}
+	values := map[string][]*yaml.Node{}
+	for _, c := range children {
+		tag := c.FullTag()
+		if _, found := values[tag]; !found {
+			tags = append(tags, tag)
+		}
+		values[tag] = append(values[tag], xmlNode(c).YNode())
+	}
+	for _, tag := range tags {
+		value := values[tag][0]
+		if len(values[tag]) > 1 {
+			value = &yaml.Node{Kind: yaml.SequenceNode, Content: values[tag]}
+		}
+		node.YNode().Content = append(node.YNode().Content, yaml.NewStringRNode(tag).YNode(), value)
+	}
+	return node
+}
+
+// GetNode returns the attribute or the first element at path as a node (see
+// [xmlNode]).
+func (e *xmlExtender) GetNode(path []string) (*yaml.RNode, error) {
+	selection, err := e.lookup(path, false)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while getting path %s", strings.Join(path, "."))
+	}
+	if selection.attr != "" {
+		value, err := e.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		return yaml.NewStringRNode(string(value)), nil
+	}
+	return xmlNode(selection.elements[0]), nil
+}
+
+// setXmlContent replaces the content of element with the content of the
+// mapping node. Keys starting with @ become attributes, the #text key becomes
+// the element text and other keys become child elements. Sequence values
+// produce repeated child elements.
+func setXmlContent(element *etree.Element, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		element.SetText(node.Value)
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			key := node.Content[i].Value
+			value := node.Content[i+1]
+			switch {
+			case strings.HasPrefix(key, "@"):
+				if value.Kind != yaml.ScalarNode {
+					return fmt.Errorf("attribute %s must be a scalar", key)
+				}
+				element.CreateAttr(key[1:], value.Value)
+			case key == "#text":
+				if value.Kind != yaml.ScalarNode {
+					return fmt.Errorf("text must be a scalar")
+				}
+				element.SetText(value.Value)
+			case value.Kind == yaml.SequenceNode:
+				for _, item := range value.Content {
+					if err := setXmlContent(element.CreateElement(key), item); err != nil {
+						return err
+					}
+				}
+			default:
+				if err := setXmlContent(element.CreateElement(key), value); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("cannot convert node of kind %d into xml", node.Kind)
+	}
+	return nil
+}
+
+// xmlNamespaceAttrs returns the namespace declarations of element, i.e. its
+// xmlns and xmlns:* attributes.
+func xmlNamespaceAttrs(element *etree.Element) []etree.Attr {
+	attrs := []etree.Attr{}
+	for _, attr := range element.Attr {
+		if attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns") {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// Set modifies the attribute or the elements at path with value.
+//
+// If value is a mapping, the content of the selected elements is replaced by
+// the conversion of the mapping (see [NewXmlExtender]). Their namespace
+// declarations are kept. Otherwise, the text of
+// the elements or the attribute value is set.
+func (e *xmlExtender) Set(path []string, value any) error {
+	selection, err := e.lookup(path, true)
+	if err != nil {
+		return errors.WrapPrefixf(err, "while setting path %s", strings.Join(path, "."))
+	}
+
+	if selection.attr != "" {
+		for _, element := range selection.elements {
+			element.CreateAttr(selection.attr, string(getByteValue(value)))
+		}
+		return nil
+	}
+
+	node, ok := value.(*yaml.Node)
+	if !ok || node.Kind == yaml.ScalarNode {
+		for _, element := range selection.elements {
+			element.SetText(string(getByteValue(value)))
+		}
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("setting non mapping object at path %s", strings.Join(path, "."))
+	}
+
+	unit := xmlIndentUnit(e.doc)
+	for _, element := range selection.elements {
+		indent, indented := xmlIndentation(element)
+		if element == e.doc.Root() && len(element.Child) > 0 && xmlIsWhitespace(element.Child[0]) {
+			// the root element content is indented from the first column
+			indent, indented = "", strings.Contains(element.Child[0].(*etree.CharData).Data, "\n")
+		}
+		element.Attr = xmlNamespaceAttrs(element)
+		for len(element.Child) > 0 {
+			element.RemoveChildAt(0)
+		}
+		if err := setXmlContent(element, node); err != nil {
+			return errors.WrapPrefixf(err, "while setting path %s", strings.Join(path, "."))
+		}
+		if indented {
+			xmlIndentElement(element, indent, unit)
+		}
+	}
+	return nil
+}
+
+// Delete removes the attribute or the elements at path. The whitespace
+// preceding the removed elements is removed too in order to keep the
+// indentation. The root element cannot be removed. Nothing is done if the
+// path doesn't exist.
+func (e *xmlExtender) Delete(path []string) error {
+	selection, err := e.lookup(path, false)
+	if isPathNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WrapPrefixf(err, "while deleting path %s", strings.Join(path, "."))
+	}
+
+	for _, element := range selection.elements {
+		if selection.attr != "" {
+			element.RemoveAttr(selection.attr)
+			continue
+		}
+		parent := element.Parent()
+		if parent == nil || element == e.doc.Root() {
+			return fmt.Errorf("cannot delete root element %s", element.Tag)
+		}
+		index := element.Index()
+		parent.RemoveChildAt(index)
+		if index > 0 && xmlIsWhitespace(parent.Child[index-1]) {
+			parent.RemoveChildAt(index - 1)
+		}
+	}
+	return nil
+}
+
+// NewXmlExtender returns a newly created [Extender] for modifying properties
+// containing XML.
+//
+// The first segment of the path is the root element. The following segments
+// are child element tags, [key=value] predicates selecting elements by
+// attribute or child element value, or numeric indexes. The last segment can
+// be an attribute prefixed by @. For instance:
+//
+//	!!xml.Server.Service.[name=Catalina].Connector.@port
+//
+// Sets the port attribute of the Connector elements of the Catalina service.
+//
+// When the source is a mapping, the content of the target element is replaced.
+// Keys prefixed with @ become attributes, #text becomes the element text and
+// other keys become child elements.
+//
+// This [Extender] preserves the element ordering, the comments and the
+// namespace prefixes.
+func NewXmlExtender() Extender {
+	return &xmlExtender{}
+}
@@ -15,11 +15,19 @@ func _() {
 	_ = x[JsonExtender-4]
 	_ = x[TomlExtender-5]
 	_ = x[IniExtender-6]
+	_ = x[XmlExtender-7]
+	_ = x[PropertiesExtender-8]
+	_ = x[EnvExtender-9]
+	_ = x[HclExtender-10]
+	_ = x[GzipExtender-11]
+	_ = x[ZlibExtender-12]
+	_ = x[PemExtender-13]
+	_ = x[SopsExtender-14]
 }
 
-const _ExtenderType_name = "UnknownYamlExtenderBase64ExtenderRegexExtenderJsonExtenderTomlExtenderIniExtender"
+const _ExtenderType_name = "UnknownYamlExtenderBase64ExtenderRegexExtenderJsonExtenderTomlExtenderIniExtenderXmlExtenderPropertiesExtenderEnvExtenderHclExtenderGzipExtenderZlibExtenderPemExtenderSopsExtender"
 
-var _ExtenderType_index = [...]uint8{0, 7, 19, 33, 46, 58, 70, 81}
+var _ExtenderType_index = [...]uint8{0, 7, 19, 33, 46, 58, 70, 81, 92, 110, 121, 132, 144, 156, 167, 179}
 
 func (i ExtenderType) String() string {
 	if i < 0 || i >= ExtenderType(len(_ExtenderType_index)-1) {
@@ -0,0 +1,504 @@
+package extras
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+)
+
+// shortShaLength is the length of abbreviated commit hashes.
+const shortShaLength = 7
+
+// gitRepository gives the properties of the current commit of a repository.
+type gitRepository struct {
+	repo   *git.Repository
+	head   *plumbing.Reference
+	commit *object.Commit
+	// tags contains the tag names by commit. It is computed on demand.
+	tags map[plumbing.Hash][]string
+}
+
+// openGitRepository opens the git repository containing path.
+func openGitRepository(path string) (*gitRepository, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "opening git repo")
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "getting current branch")
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "getting current commit")
+	}
+	return &gitRepository{repo: repo, head: head, commit: commit}, nil
+}
+
+// isDetached returns true if HEAD doesn't point to a branch.
+func (r *gitRepository) isDetached() bool {
+	return !r.head.Name().IsBranch()
+}
+
+// sha returns the full hash of the current commit.
+func (r *gitRepository) sha() string {
+	return r.commit.Hash.String()
+}
+
+// shortSha returns the abbreviated hash of the current commit.
+func (r *gitRepository) shortSha() string {
+	return r.sha()[:shortShaLength]
+}
+
+// commitTags returns the tag names by commit. Annotated tags are resolved to
+// the commit they point to.
+func (r *gitRepository) commitTags() (map[plumbing.Hash][]string, error) {
+	if r.tags != nil {
+		return r.tags, nil
+	}
+	iter, err := r.repo.Tags()
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "getting tags")
+	}
+	tags := map[plumbing.Hash][]string{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		tag, err := r.repo.TagObject(hash)
+		switch err {
+		case nil:
+			commit, err := tag.Commit()
+			if err != nil {
+				// Tag of something else than a commit
+				return nil //nolint:nilerr // ignored tag
+			}
+			hash = commit.Hash
+		case plumbing.ErrObjectNotFound:
+			// Lightweight tag
+		default:
+			return err
+		}
+		tags[hash] = append(tags[hash], ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "reading tags")
+	}
+	for _, names := range tags {
+		sort.Strings(names)
+	}
+	r.tags = tags
+	return tags, nil
+}
+
+// countCommits returns the number of commits reachable from hash, hash
+// included.
+func (r *gitRepository) countCommits(hash plumbing.Hash) (int, error) {
+	commits, err := r.repo.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return 0, errors.WrapPrefixf(err, "getting history of %s", hash)
+	}
+	count := 0
+	err = commits.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, errors.WrapPrefixf(err, "walking history of %s", hash)
+	}
+	return count, nil
+}
+
+// nearestTag returns the nearest tag reachable from the current commit and
+// the number of commits between them, like git describe does: the distance is
+// the number of commits reachable from the current commit but not from the
+// tag, and the tag with the smallest distance is returned. On equal
+// distances, the most recent tagged commit wins. If several tags point to the
+// same commit, the last one in lexical order is returned. It returns an empty
+// tag if no tag is reachable.
+func (r *gitRepository) nearestTag() (tag string, distance int, err error) {
+	tags, err := r.commitTags()
+	if err != nil {
+		return "", 0, err
+	}
+	if len(tags) == 0 {
+		return "", 0, nil
+	}
+	commits, err := r.repo.Log(&git.LogOptions{From: r.commit.Hash, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return "", 0, errors.WrapPrefixf(err, "getting history")
+	}
+	count := 0
+	candidates := []plumbing.Hash{}
+	err = commits.ForEach(func(c *object.Commit) error {
+		if _, ok := tags[c.Hash]; ok {
+			candidates = append(candidates, c.Hash)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return "", 0, errors.WrapPrefixf(err, "walking history")
+	}
+
+	// As tagged commits are reachable from the current commit, the commits
+	// reachable from the latter but not from the former are the difference
+	// between the sizes of their histories.
+	for _, candidate := range candidates {
+		tagCount, err := r.countCommits(candidate)
+		if err != nil {
+			return "", 0, err
+		}
+		if tag == "" || count-tagCount < distance {
+			names := tags[candidate]
+			tag, distance = names[len(names)-1], count-tagCount
+		}
+	}
+	return tag, distance, nil
+}
+
+// exactTag returns the tag pointing to the current commit or an empty string.
+func (r *gitRepository) exactTag() (string, error) {
+	tags, err := r.commitTags()
+	if err != nil {
+		return "", err
+	}
+	names := tags[r.commit.Hash]
+	if len(names) == 0 {
+		return "", nil
+	}
+	return names[len(names)-1], nil
+}
+
+// describe returns a description of the current commit similar to the one of
+// git describe --tags --always.
+func (r *gitRepository) describe() (string, error) {
+	tag, distance, err := r.nearestTag()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case tag == "":
+		return r.shortSha(), nil
+	case distance == 0:
+		return tag, nil
+	}
+	return fmt.Sprintf("%s-%d-g%s", tag, distance, r.shortSha()), nil
+}
+
+// isDirty returns true if the worktree contains uncommitted changes,
+// untracked files included.
+func (r *gitRepository) isDirty() (bool, error) {
+	worktree, err := r.repo.Worktree()
+	if err != nil {
+		return false, errors.WrapPrefixf(err, "getting worktree")
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return false, errors.WrapPrefixf(err, "getting worktree status")
+	}
+	return !status.IsClean(), nil
+}
+
+// relativePath returns the path of dir relative to the root of the worktree,
+// with forward slashes.
+func (r *gitRepository) relativePath(dir string) (string, error) {
+	worktree, err := r.repo.Worktree()
+	if err != nil {
+		return "", errors.WrapPrefixf(err, "getting worktree")
+	}
+	root, err := filepath.EvalSymlinks(worktree.Filesystem.Root())
+	if err != nil {
+		return "", err
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(path), nil
+}
+
+// GitProperty is an optional property of the current commit.
+type GitProperty string
+
+const (
+	// CommitShaProperty is the full hash of the current commit.
+	CommitShaProperty GitProperty = "commitSha"
+	// ShortShaProperty is the abbreviated hash of the current commit.
+	ShortShaProperty GitProperty = "shortSha"
+	// TagProperty is the nearest tag reachable from the current commit.
+	TagProperty GitProperty = "tag"
+	// DescribeProperty is the output of git describe --tags --always.
+	DescribeProperty GitProperty = "describe"
+	// CommitTimeProperty is the committer time of the current commit in
+	// RFC 3339 format.
+	CommitTimeProperty GitProperty = "commitTime"
+	// AuthorProperty is the author of the current commit.
+	AuthorProperty GitProperty = "author"
+	// DirtyProperty is true if the worktree contains uncommitted changes.
+	DirtyProperty GitProperty = "dirty"
+	// PathProperty is the path of the function directory relative to the
+	// root of the repository.
+	PathProperty GitProperty = "path"
+)
+
+// property returns the value of the property name. dir is the directory of
+// the function.
+func (r *gitRepository) property(name GitProperty, dir string) (string, error) {
+	switch name {
+	case CommitShaProperty:
+		return r.sha(), nil
+	case ShortShaProperty:
+		return r.shortSha(), nil
+	case TagProperty:
+		tag, _, err := r.nearestTag()
+		return tag, err
+	case DescribeProperty:
+		return r.describe()
+	case CommitTimeProperty:
+		return r.commit.Committer.When.UTC().Format(time.RFC3339), nil
+	case AuthorProperty:
+		return r.commit.Author.String(), nil
+	case DirtyProperty:
+		dirty, err := r.isDirty()
+		return strconv.FormatBool(dirty), err
+	case PathProperty:
+		return r.relativePath(dir)
+	}
+	return "", fmt.Errorf("unknown git property %s", name)
+}
+
+// Revisions used as fallback for detached HEAD.
+const (
+	// TagRevision is the tag pointing to the current commit, if any.
+	TagRevision = "tag"
+	// ShaRevision is the full hash of the current commit.
+	ShaRevision = "sha"
+	// ShortShaRevision is the abbreviated hash of the current commit.
+	ShortShaRevision = "shortSha"
+	// envRevisionPrefix prefixes the name of an environment variable
+	// containing the revision.
+	envRevisionPrefix = "env:"
+)
+
+// revision returns the name of the current branch. If HEAD is detached, the
+// fallbacks are tried in order and the first non empty one is returned. If
+// none is found, HEAD is returned.
+func (r *gitRepository) revision(fallbacks []string) (string, error) {
+	if !r.isDetached() {
+		return r.head.Name().Short(), nil
+	}
+	for _, fallback := range fallbacks {
+		var revision string
+		switch {
+		case fallback == TagRevision:
+			tag, err := r.exactTag()
+			if err != nil {
+				return "", err
+			}
+			revision = tag
+		case fallback == ShaRevision:
+			revision = r.sha()
+		case fallback == ShortShaRevision:
+			revision = r.shortSha()
+		case strings.HasPrefix(fallback, envRevisionPrefix):
+			revision = os.Getenv(strings.TrimPrefix(fallback, envRevisionPrefix))
+		default:
+			return "", fmt.Errorf("unknown detached HEAD fallback %s", fallback)
+		}
+		if revision != "" {
+			return revision, nil
+		}
+	}
+	return r.head.Name().Short(), nil
+}
+
+// Git URL formats.
+const (
+	// HTTPSURLFormat is the https://host/path format.
+	HTTPSURLFormat = "https"
+	// SSHURLFormat is the ssh://user@host/path format.
+	SSHURLFormat = "ssh"
+	// SCPURLFormat is the scp-like user@host:path format.
+	SCPURLFormat = "scp"
+)
+
+// Operations on the .git suffix of URLs.
+const (
+	// AddGitSuffix adds the .git suffix if missing.
+	AddGitSuffix = "add"
+	// StripGitSuffix removes the .git suffix if present.
+	StripGitSuffix = "strip"
+)
+
+// defaultSSHUser is the user of ssh URLs when none is specified.
+const defaultSSHUser = "git"
+
+// GitURLRewrite rewrites the URLs starting with one of InsteadOf to start with
+// URL instead, like the url.<base>.insteadOf git configuration.
+type GitURLRewrite struct {
+	URL       string   `json:"url" yaml:"url"`
+	InsteadOf []string `json:"insteadOf" yaml:"insteadOf"`
+}
+
+// GitURLOptions specify how to normalize git remote URLs.
+type GitURLOptions struct {
+	// Rewrites applied first. The longest matching prefix wins.
+	Rewrites []GitURLRewrite `json:"rewrites,omitempty" yaml:"rewrites,omitempty"`
+	// Format of the URL: https, ssh or scp. If empty, the format is kept.
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// If true, user names and passwords are removed from https URLs and
+	// passwords from ssh URLs.
+	StripCredentials bool `json:"stripCredentials,omitempty" yaml:"stripCredentials,omitempty"`
+	// Add or strip the .git suffix. If empty, the suffix is kept.
+	GitSuffix string `json:"gitSuffix,omitempty" yaml:"gitSuffix,omitempty"`
+}
+
+// rewrite applies the first rewrite with the longest prefix of rawURL.
+func (o *GitURLOptions) rewrite(rawURL string) string {
+	base, prefix := "", ""
+	for _, rewrite := range o.Rewrites {
+		for _, insteadOf := range rewrite.InsteadOf {
+			if strings.HasPrefix(rawURL, insteadOf) && len(insteadOf) > len(prefix) {
+				base, prefix = rewrite.URL, insteadOf
+			}
+		}
+	}
+	if prefix == "" {
+		return rawURL
+	}
+	return base + strings.TrimPrefix(rawURL, prefix)
+}
+
+// Normalize returns rawURL normalized according to the options.
+func (o *GitURLOptions) Normalize(rawURL string) (string, error) {
+	if o == nil {
+		return rawURL, nil
+	}
+	rawURL = o.rewrite(rawURL)
+	if o.Format == "" && !o.StripCredentials && o.GitSuffix == "" {
+		return rawURL, nil
+	}
+
+	u, err := parseGitURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		// Local repositories can only be kept as is.
+		if o.Format != "" {
+			return "", fmt.Errorf("cannot convert git URL %s without host to %s format", rawURL, o.Format)
+		}
+		return rawURL, nil
+	}
+
+	switch o.GitSuffix {
+	case "":
+	case AddGitSuffix:
+		if !strings.HasSuffix(u.Path, ".git") {
+			u.Path += ".git"
+		}
+	case StripGitSuffix:
+		u.Path = strings.TrimSuffix(u.Path, ".git")
+	default:
+		return "", fmt.Errorf("unknown git suffix operation %s", o.GitSuffix)
+	}
+
+	format := o.Format
+	if format == "" {
+		format = u.format()
+	}
+	switch format {
+	case HTTPSURLFormat:
+		if u.Scheme != "http" && u.Scheme != "https" {
+			u.User = nil
+			u.Host = u.Hostname()
+		}
+		u.Scheme = "https"
+		if o.StripCredentials {
+			u.User = nil
+		}
+	case SSHURLFormat, SCPURLFormat:
+		if u.Scheme != "ssh" {
+			u.User = url.User(defaultSSHUser)
+			u.Host = u.Hostname()
+			u.Scheme = "ssh"
+		}
+		if o.StripCredentials && u.User != nil {
+			u.User = url.User(u.User.Username())
+		}
+		if format == SCPURLFormat {
+			if u.Port() != "" {
+				return "", fmt.Errorf("cannot convert %s with port to scp-like format", rawURL)
+			}
+			user := ""
+			if u.User != nil {
+				user = u.User.String() + "@"
+			}
+			return fmt.Sprintf("%s%s:%s", user, u.Host, strings.TrimPrefix(u.Path, "/")), nil
+		}
+	default:
+		if format != u.format() {
+			return "", fmt.Errorf("unknown git URL format %s", format)
+		}
+		if o.StripCredentials {
+			u.User = nil
+		}
+	}
+	return u.String(), nil
+}
+
+// scpURLRegexp matches scp-like git URLs.
+var scpURLRegexp = regexp.MustCompile(`^(?:([^@/]+)@)?([^:/]+):(.*)$`)
+
+// gitURL is a parsed git URL. scp-like URLs are parsed as ssh URLs.
+type gitURL struct {
+	*url.URL
+	scp bool
+}
+
+// format returns the format of the URL.
+func (u *gitURL) format() string {
+	switch {
+	case u.scp:
+		return SCPURLFormat
+	case u.Scheme == "ssh":
+		return SSHURLFormat
+	case u.Scheme == "https":
+		return HTTPSURLFormat
+	}
+	return u.Scheme
+}
+
+// parseGitURL parses rawURL that can be a URL, a scp-like address or a local
+// path. Local paths and file URLs have no host.
+func parseGitURL(rawURL string) (*gitURL, error) {
+	if !strings.Contains(rawURL, "://") {
+		if matches := scpURLRegexp.FindStringSubmatch(rawURL); matches != nil {
+			u := &url.URL{Scheme: "ssh", Host: matches[2], Path: "/" + matches[3]}
+			if matches[1] != "" {
+				u.User = url.User(matches[1])
+			}
+			return &gitURL{URL: u, scp: true}, nil
+		}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "parsing git URL %s", rawURL)
+	}
+	return &gitURL{URL: u}, nil
+}
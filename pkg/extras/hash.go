@@ -0,0 +1,207 @@
+package extras
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec // apr1 is based on md5
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/blowfish"
+)
+
+// saltBytes returns n bytes of salt. If seed is empty, the salt is random.
+// Otherwise it is derived from seed and target, so that hashing the same value
+// for the same target gives the same result. The salt is stored in clear in
+// the hash, so it must never be derived from the hashed value.
+func saltBytes(seed, target string, n int) ([]byte, error) {
+	if seed == "" {
+		salt := make([]byte, n)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		return salt, nil
+	}
+	mac := hmac.New(sha256.New, []byte(seed))
+	mac.Write([]byte(target))
+	return mac.Sum(nil)[:n], nil
+}
+
+///////
+// Bcrypt
+///////
+
+// bcryptSaltSize is the size in bytes of bcrypt salts.
+const bcryptSaltSize = 16
+
+// bcryptEncoding is the base 64 encoding used by bcrypt.
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// bcryptHash returns the bcrypt hash of value with cost. A zero cost means
+// the default cost. If seed is not empty, the salt is derived from it and
+// target.
+func bcryptHash(value string, cost int, seed, target string) (string, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return "", fmt.Errorf("bcrypt cost %d is not between %d and %d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if seed == "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(value), cost)
+		return string(hash), err
+	}
+	salt, err := saltBytes(seed, target, bcryptSaltSize)
+	if err != nil {
+		return "", err
+	}
+	return bcryptWithSalt([]byte(value), cost, salt)
+}
+
+// bcryptWithSalt returns the bcrypt hash of password with cost and salt. It
+// follows the implementation of golang.org/x/crypto/bcrypt that doesn't allow
+// providing the salt. Like it, it rejects passwords longer than 72 bytes.
+func bcryptWithSalt(password []byte, cost int, salt []byte) (string, error) {
+	if len(password) > 72 {
+		return "", bcrypt.ErrPasswordTooLong
+	}
+	// The trailing NULL of the key is used, like in C implementations.
+	key := append(password[:len(password):len(password)], 0)
+	c, err := blowfish.NewSaltedCipher(key, salt)
+	if err != nil {
+		return "", err
+	}
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		blowfish.ExpandKey(key, c)
+		blowfish.ExpandKey(salt, c)
+	}
+
+	cipherData := []byte("OrpheanBeholderScryDoubt")
+	for i := 0; i < 24; i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(cipherData[i:i+8], cipherData[i:i+8])
+		}
+	}
+
+	// Only 23 of the 24 bytes are encoded, like in C implementations.
+	return fmt.Sprintf("$2a$%02d$%s%s", cost, bcryptEncoding.EncodeToString(salt), bcryptEncoding.EncodeToString(cipherData[:23])), nil
+}
+
+// bcryptVerify returns true if hash is the bcrypt hash of password with cost.
+// A zero cost means the default cost.
+func bcryptVerify(hash, password string, cost int) bool {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	if hashCost, err := bcrypt.Cost([]byte(hash)); err != nil || hashCost != cost {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+///////
+// Apr1
+///////
+
+// apr1Magic is the prefix of apr1 hashes.
+const apr1Magic = "$apr1$"
+
+// apr1Alphabet is the alphabet used by the crypt(3) base 64 encoding.
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1Salt returns a 8 characters salt. If seed is not empty, the salt is
+// derived from it and target.
+func apr1Salt(seed, target string) ([]byte, error) {
+	salt, err := saltBytes(seed, target, 8)
+	if err != nil {
+		return nil, err
+	}
+	for i, b := range salt {
+		salt[i] = apr1Alphabet[int(b)%len(apr1Alphabet)]
+	}
+	return salt, nil
+}
+
+// apr1Crypt returns the Apache MD5 hash of password with salt.
+func apr1Crypt(password, salt []byte) string {
+	alternate := md5.New() //nolint:gosec // apr1 is based on md5
+	alternate.Write(password)
+	alternate.Write(salt)
+	alternate.Write(password)
+	alternateSum := alternate.Sum(nil)
+
+	h := md5.New() //nolint:gosec // apr1 is based on md5
+	h.Write(password)
+	h.Write([]byte(apr1Magic))
+	h.Write(salt)
+	for i := len(password); i > 0; i -= 16 {
+		if i > 16 {
+			h.Write(alternateSum)
+		} else {
+			h.Write(alternateSum[:i])
+		}
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(password[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New() //nolint:gosec // apr1 is based on md5
+		if i&1 != 0 {
+			round.Write(password)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write(salt)
+		}
+		if i%7 != 0 {
+			round.Write(password)
+		}
+		if i&1 != 0 {
+			round.Write(sum)
+		} else {
+			round.Write(password)
+		}
+		sum = round.Sum(nil)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(apr1Magic)
+	b.Write(salt)
+	b.WriteByte('$')
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, i := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(sum[i[0]])<<16|uint(sum[i[1]])<<8|uint(sum[i[2]]), 4)
+	}
+	encode(uint(sum[11]), 2)
+	return b.String()
+}
+
+// apr1Verify returns true if hash is the apr1 hash of password.
+func apr1Verify(hash, password string) bool {
+	if !strings.HasPrefix(hash, apr1Magic) {
+		return false
+	}
+	salt, _, found := strings.Cut(strings.TrimPrefix(hash, apr1Magic), "$")
+	if !found {
+		return false
+	}
+	expected := apr1Crypt([]byte(password), []byte(salt))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+}
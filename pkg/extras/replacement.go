@@ -5,6 +5,7 @@ package extras
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
 
@@ -15,31 +16,100 @@ import (
 	"sigs.k8s.io/kustomize/api/resource"
 	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
 	"sigs.k8s.io/kustomize/kyaml/resid"
 	kyaml_utils "sigs.k8s.io/kustomize/kyaml/utils"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+// defaultSourceSet is the name of the source set made of the source and
+// sources fields of [ExtendedReplacementTransformerPlugin].
+const defaultSourceSet = ""
+
+// sourceNotFoundError is returned when the source of a replacement is not
+// found.
+type sourceNotFoundError string
+
+func (e sourceNotFoundError) Error() string {
+	return string(e)
+}
+
+// isSourceNotFound returns true if err is or wraps a [sourceNotFoundError].
+func isSourceNotFound(err error) bool {
+	var notFound sourceNotFoundError
+	return errors.As(err, &notFound)
+}
+
+// ResultsReporter is implemented by the plugins reporting results about their
+// last run.
+type ResultsReporter interface {
+	// Results returns the results of the last run.
+	Results() framework.Results
+}
+
 type extendedFilter struct {
-	Replacements []types.Replacement `json:"replacements,omitempty" yaml:"replacements,omitempty"`
-	sourceNodes  []*yaml.RNode
+	Replacements []Replacement `json:"replacements,omitempty" yaml:"replacements,omitempty"`
+	// sourceSets contains the resources of each source set indexed by name.
+	sourceSets map[string][]*yaml.RNode
+	// allowedEnvVars contains the environment variables that can be used as
+	// sources.
+	allowedEnvVars []string
+	// results receives the replacements that have been skipped, if not nil.
+	results *framework.Results
+}
+
+// sourceNodes returns the lists of nodes in which the sources of r are looked
+// for, in order of priority. The resources of source and sources replace the
+// in-pipeline nodes, while a named source set falls back to them.
+func (f extendedFilter) sourceNodes(r *Replacement, nodes []*yaml.RNode) ([][]*yaml.RNode, error) {
+	set, ok := f.sourceSets[r.SourceSet]
+	switch {
+	case !ok && r.SourceSet != defaultSourceSet:
+		return nil, fmt.Errorf("unknown source set %s", r.SourceSet)
+	case !ok:
+		return [][]*yaml.RNode{nodes}, nil
+	case r.SourceSet == defaultSourceSet:
+		return [][]*yaml.RNode{set}, nil
+	}
+	return [][]*yaml.RNode{set, nodes}, nil
 }
 
 // Filter replaces values of targets with values from sources
 func (f extendedFilter) Filter(nodes []*yaml.RNode) ([]*yaml.RNode, error) {
-	sourceNodes := f.sourceNodes
-	if sourceNodes == nil {
-		sourceNodes = nodes
-	}
 	for i, r := range f.Replacements {
-		if r.Source == nil || r.Targets == nil {
-			return nil, fmt.Errorf("replacements must specify a source and at least one target")
-		}
-		value, err := getReplacement(sourceNodes, &f.Replacements[i])
+		needsSource, err := r.needsSource()
 		if err != nil {
 			return nil, err
 		}
-		nodes, err = applyReplacement(nodes, value, r.Targets)
+		if (r.sourceCount() == 0 && needsSource) || r.Targets == nil {
+			return nil, fmt.Errorf("replacements must specify a source and at least one target")
+		}
+		if r.sourceCount() > 1 {
+			return nil, fmt.Errorf("replacements must specify only one of source, template, value or envVar")
+		}
+		var value *yaml.RNode
+		var last *targetTransform
+		if r.sourceCount() > 0 {
+			value, last, err = f.getReplacement(nodes, &f.Replacements[i])
+			if isSourceNotFound(err) {
+				switch {
+				case !r.Default.IsZero():
+					value, last, err = yaml.NewRNode(&f.Replacements[i].Default), nil, nil
+				case r.Optional:
+					if f.results != nil {
+						*f.results = append(*f.results, &framework.Result{
+							Message:  fmt.Sprintf("replacement %d skipped: %v", i, err),
+							Severity: framework.Info,
+						})
+					}
+					continue
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		nodes, err = applyReplacement(nodes, value, last, r.Targets)
 		if err != nil {
 			return nil, err
 		}
@@ -47,52 +117,142 @@ func (f extendedFilter) Filter(nodes []*yaml.RNode) ([]*yaml.RNode, error) {
 	return nodes, nil
 }
 
-func getReplacement(nodes []*yaml.RNode, r *types.Replacement) (*yaml.RNode, error) {
-	source, err := selectSourceNode(nodes, r.Source)
+// getReplacement returns the value of the replacement r, looking for its
+// sources in nodes. The returned [targetTransform], if not nil, gives the value
+// of each target.
+func (f extendedFilter) getReplacement(nodes []*yaml.RNode, r *Replacement) (*yaml.RNode, *targetTransform, error) {
+	switch {
+	case !r.Value.IsZero():
+		return yaml.NewRNode(&r.Value), nil, nil
+	case r.EnvVar != "":
+		value, err := f.getEnvVarValue(r.EnvVar)
+		return value, nil, err
+	}
+	sourceNodes, err := f.sourceNodes(r, nodes)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return getReplacement(sourceNodes, r)
+}
+
+// getEnvVarValue returns the value of the environment variable name if it is
+// allowed.
+func (f extendedFilter) getEnvVarValue(name string) (*yaml.RNode, error) {
+	allowed := false
+	for _, allowedName := range f.allowedEnvVars {
+		if allowedName == name {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("environment variable %s is not allowed", name)
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, sourceNotFoundError(fmt.Sprintf("environment variable %s is not set", name))
+	}
+	return yaml.NewStringRNode(value), nil
+}
+
+func getReplacement(nodes [][]*yaml.RNode, r *Replacement) (*yaml.RNode, *targetTransform, error) {
+	if r.Template != "" {
+		value, err := getTemplateReplacement(nodes, r)
+		return value, nil, err
+	}
+	value, last, err := getSourceValue(nodes, r.Source)
+	if r.Fallback != nil && isSourceNotFound(err) {
+		value, last, err = getSourceValue(nodes, r.Fallback)
+	}
+	return value, last, err
+}
+
+// getSourceValue returns the value selected by selector in nodes, as well as
+// the [targetTransform] of its last transform if the value depends on the
+// target.
+func getSourceValue(nodes [][]*yaml.RNode, selector *SourceSelector) (*yaml.RNode, *targetTransform, error) {
+	source, err := selectSourceNode(nodes, &selector.SourceSelector)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if r.Source.FieldPath == "" {
-		r.Source.FieldPath = types.DefaultReplacementFieldPath
+	if selector.FieldPath == "" {
+		selector.FieldPath = types.DefaultReplacementFieldPath
+	}
+	fieldPath := kyaml_utils.SmarterPathSplitter(selector.FieldPath, ".")
+	extendedPath, err := NewExtendedPath(fieldPath)
+	if err != nil {
+		return nil, nil, err
 	}
-	fieldPath := kyaml_utils.SmarterPathSplitter(r.Source.FieldPath, ".")
 
-	rn, err := source.Pipe(yaml.Lookup(fieldPath...))
+	rn, err := extendedPath.Get(source)
 	if err != nil {
-		return nil, fmt.Errorf("error looking up replacement source: %w", err)
+		return nil, nil, fmt.Errorf("error looking up replacement source: %w", err)
 	}
 	if rn.IsNilOrEmpty() {
-		return nil, fmt.Errorf("fieldPath `%s` is missing for replacement source %s", r.Source.FieldPath, r.Source.ResId)
+		return nil, nil, sourceNotFoundError(fmt.Sprintf("fieldPath `%s` is missing for replacement source %s", selector.FieldPath, selector.ResId))
 	}
 
-	return getRefinedValue(r.Source.Options, rn)
+	value, err := getRefinedValue(selector.Options, rn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return applyTransforms(selector.Transforms, value)
 }
 
 // selectSourceNode finds the node that matches the selector, returning
-// an error if multiple or none are found
-func selectSourceNode(nodes []*yaml.RNode, selector *types.SourceSelector) (*yaml.RNode, error) {
-	var matches []*yaml.RNode
-	for _, n := range nodes {
-		ids, err := makeResIds(n)
-		if err != nil {
-			return nil, fmt.Errorf("error getting node IDs: %w", err)
-		}
-		for _, id := range ids {
-			if id.IsSelectedBy(selector.ResId) {
-				if len(matches) > 0 {
-					return nil, fmt.Errorf(
-						"multiple matches for selector %s", selector)
+// an error if multiple or none are found. The lists of nodes are searched in
+// order and the first list containing a match is used.
+func selectSourceNode(nodes [][]*yaml.RNode, selector *types.SourceSelector) (*yaml.RNode, error) {
+	for _, list := range nodes {
+		var matches []*yaml.RNode
+		for _, n := range list {
+			ids, err := makeResIds(n)
+			if err != nil {
+				return nil, fmt.Errorf("error getting node IDs: %w", err)
+			}
+			for _, id := range ids {
+				if id.IsSelectedBy(selector.ResId) {
+					if len(matches) > 0 {
+						return nil, fmt.Errorf(
+							"multiple matches for selector %s", selector)
+					}
+					matches = append(matches, n)
+					break
 				}
-				matches = append(matches, n)
-				break
 			}
 		}
+		if len(matches) > 0 {
+			return matches[0], nil
+		}
 	}
-	if len(matches) == 0 {
-		return nil, fmt.Errorf("nothing selected by %s", selector)
+	return nil, sourceNotFoundError(fmt.Sprintf("nothing selected by %s", selector))
+}
+
+// mergeSourceNodes merges the layers of resources in order. When a resource
+// has the same id as a resource of a previous layer, it is merged into it:
+// mappings are merged recursively and other values are replaced.
+func mergeSourceNodes(layers ...[]*yaml.RNode) ([]*yaml.RNode, error) {
+	result := []*yaml.RNode{}
+	ids := []resid.ResId{}
+	for _, layer := range layers {
+	nodes:
+		for _, n := range layer {
+			nodeIds, err := makeResIds(n)
+			if err != nil {
+				return nil, fmt.Errorf("error getting node IDs: %w", err)
+			}
+			for i, id := range ids {
+				if id.Equals(nodeIds[0]) {
+					mergeMapping(result[i].YNode(), n.Copy().YNode())
+					continue nodes
+				}
+			}
+			result = append(result, n.Copy())
+			ids = append(ids, nodeIds[0])
+		}
 	}
-	return matches[0], nil
+	return result, nil
 }
 
 func getRefinedValue(options *types.FieldOptions, rn *yaml.RNode) (*yaml.RNode, error) {
@@ -120,7 +280,7 @@ func getRefinedValue(options *types.FieldOptions, rn *yaml.RNode) (*yaml.RNode,
 	return n, nil
 }
 
-func applyReplacement(nodes []*yaml.RNode, value *yaml.RNode, targetSelectors []*types.TargetSelector) ([]*yaml.RNode, error) {
+func applyReplacement(nodes []*yaml.RNode, value *yaml.RNode, last *targetTransform, targetSelectors []*TargetSelector) ([]*yaml.RNode, error) {
 	for _, selector := range targetSelectors {
 		if selector.Select == nil {
 			return nil, errors.New("target must specify resources to select")
@@ -146,7 +306,7 @@ func applyReplacement(nodes []*yaml.RNode, value *yaml.RNode, targetSelectors []
 			// filter targets by matching resource IDs
 			for i, id := range ids {
 				if id.IsSelectedBy(selector.Select.ResId) && !rejectId(selector.Reject, &ids[i]) {
-					err := copyValueToTarget(possibleTarget, value, selector)
+					err := copyValueToTarget(possibleTarget, value, last, selector)
 					if err != nil {
 						return nil, err
 					}
@@ -158,7 +318,7 @@ func applyReplacement(nodes []*yaml.RNode, value *yaml.RNode, targetSelectors []
 	return nodes, nil
 }
 
-func selectByAnnoAndLabel(n *yaml.RNode, t *types.TargetSelector) (bool, error) {
+func selectByAnnoAndLabel(n *yaml.RNode, t *TargetSelector) (bool, error) {
 	if matchesSelect, err := matchesAnnoAndLabelSelector(n, t.Select); !matchesSelect || err != nil {
 		return false, err
 	}
@@ -195,20 +355,35 @@ func rejectId(rejects []*types.Selector, id *resid.ResId) bool {
 	return false
 }
 
-func copyValueToTarget(target *yaml.RNode, value *yaml.RNode, selector *types.TargetSelector) error {
+func copyValueToTarget(target *yaml.RNode, value *yaml.RNode, last *targetTransform, selector *TargetSelector) error {
+	operation, err := selector.Options.GetOperation()
+	if err != nil {
+		return err
+	}
 	for _, fp := range selector.FieldPaths {
 		fieldPath := kyaml_utils.SmarterPathSplitter(fp, ".")
 		extendedPath, err := NewExtendedPath(fieldPath)
 		if err != nil {
 			return err
 		}
+
+		if operation == DeleteOperation && !extendedPath.HasExtensions() && !hasDelimiter(selector.Options) {
+			if err := deleteField(target, extendedPath.ResourcePath); err != nil {
+				return err
+			}
+			continue
+		}
+
 		create, err := shouldCreateField(selector.Options, extendedPath.ResourcePath)
 		if err != nil {
 			return err
 		}
 
 		var targetFields []*yaml.RNode
-		if create {
+		if len(extendedPath.ResourcePath) == 0 && extendedPath.HasExtensions() {
+			// The extended path applies to the whole resource
+			targetFields = append(targetFields, target)
+		} else if create && operation != DeleteOperation {
 			createdField, createErr := target.Pipe(yaml.LookupCreate(value.YNode().Kind, extendedPath.ResourcePath...))
 			if createErr != nil {
 				return fmt.Errorf("error creating replacement node: %w", createErr)
@@ -226,8 +401,16 @@ func copyValueToTarget(target *yaml.RNode, value *yaml.RNode, selector *types.Ta
 			}
 		}
 
+		// seeded hashes derive their salt from the target resource and field
+		fieldValue, err := last.apply(value, resid.FromRNode(target).String()+":"+fp)
+		if err != nil {
+			return err
+		}
 		for _, t := range targetFields {
-			if err := setFieldValue(selector.Options, t, value, extendedPath); err != nil {
+			if operation == ReplaceOperation && !hasDelimiter(selector.Options) && isVerified(t, extendedPath, last) {
+				continue
+			}
+			if err := setFieldValue(selector.Options, t, fieldValue, extendedPath); err != nil {
 				return err
 			}
 		}
@@ -236,9 +419,52 @@ func copyValueToTarget(target *yaml.RNode, value *yaml.RNode, selector *types.Ta
 	return nil
 }
 
-func setFieldValue(options *types.FieldOptions, targetField *yaml.RNode, value *yaml.RNode, extendedPath *ExtendedPath) error {
+// isVerified returns true if last accepts the current value of the extended
+// path in targetField.
+func isVerified(targetField *yaml.RNode, extendedPath *ExtendedPath, last *targetTransform) bool {
+	if last == nil || targetField.YNode().Kind != yaml.ScalarNode {
+		return false
+	}
+	current, err := (&ExtendedPath{ExtendedSegments: extendedPath.ExtendedSegments}).Get(targetField)
+	if err != nil || current == nil || current.YNode().Kind != yaml.ScalarNode {
+		return false
+	}
+	return last.verify(yaml.GetValue(current))
+}
+
+// hasDelimiter returns true if options specify a delimiter.
+func hasDelimiter(options *FieldOptions) bool {
+	return options != nil && options.Delimiter != ""
+}
+
+// deleteField removes the fields matching fieldPath in target.
+func deleteField(target *yaml.RNode, fieldPath []string) error {
+	if len(fieldPath) == 0 {
+		return fmt.Errorf("cannot delete the whole resource")
+	}
+	parentSequence, err := target.Pipe(&yaml.PathMatcher{Path: fieldPath[:len(fieldPath)-1]})
+	if err != nil {
+		return fmt.Errorf("error finding field in replacement target: %w", err)
+	}
+	parents, err := parentSequence.Elements()
+	if err != nil {
+		return fmt.Errorf("error fetching elements in replacement target: %w", err)
+	}
+	for _, parent := range parents {
+		if err := removeChild(parent, fieldPath[len(fieldPath)-1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFieldValue(options *FieldOptions, targetField *yaml.RNode, value *yaml.RNode, extendedPath *ExtendedPath) error {
+	operation, err := options.GetOperation()
+	if err != nil {
+		return err
+	}
 	value = value.Copy()
-	if options != nil && options.Delimiter != "" {
+	if hasDelimiter(options) {
 		if extendedPath.HasExtensions() {
 			return fmt.Errorf("delimiter option cannot be used with extensions")
 		}
@@ -246,33 +472,49 @@ func setFieldValue(options *types.FieldOptions, targetField *yaml.RNode, value *
 			return fmt.Errorf("delimiter option can only be used with scalar nodes")
 		}
 		tv := strings.Split(targetField.YNode().Value, options.Delimiter)
-		v := yaml.GetValue(value)
-		// TODO: Add a way to remove an element
-		switch {
-		case options.Index < 0: // prefix
-			tv = append([]string{v}, tv...)
-		case options.Index >= len(tv): // suffix
-			tv = append(tv, v)
-		default: // replace an element
-			tv[options.Index] = v
+		switch operation {
+		case DeleteOperation: // remove an element
+			value = targetField.Copy()
+			if options.Index >= 0 && options.Index < len(tv) {
+				tv = append(tv[:options.Index], tv[options.Index+1:]...)
+			}
+		case AppendOperation:
+			tv = append(tv, yaml.GetValue(value))
+		case MergeOperation:
+			return fmt.Errorf("merge operation cannot be used with delimiter option")
+		default:
+			v := yaml.GetValue(value)
+			switch {
+			case options.Index < 0: // prefix
+				tv = append([]string{v}, tv...)
+			case options.Index >= len(tv): // suffix
+				tv = append(tv, v)
+			default: // replace an element
+				tv[options.Index] = v
+			}
 		}
 		value.YNode().Value = strings.Join(tv, options.Delimiter)
+		operation = ReplaceOperation
 	}
 
-	if targetField.YNode().Kind == yaml.ScalarNode {
-		return extendedPath.Apply(targetField, value)
+	if targetField.YNode().Kind == yaml.ScalarNode || (extendedPath.HasExtensions() && extendedPath.isResourcePayload(targetField)) {
+		return extendedPath.ApplyOperation(targetField, value, operation)
 	} else {
 		if extendedPath.HasExtensions() {
 			return fmt.Errorf("path extensions should start at a scalar node")
 		}
 
-		targetField.SetYNode(value.YNode())
+		result, err := applyNodeOperation(targetField, value, operation)
+		if err != nil {
+			return err
+		}
+		targetField.SetYNode(result.YNode())
 	}
 
 	return nil
 }
 
-func shouldCreateField(options *types.FieldOptions, fieldPath []string) (bool, error) {
+func shouldCreateField(options *FieldOptions, fieldPath []string) (bool, error) {
 	if options == nil || !options.Create {
 		return false, nil
 	}
@@ -353,24 +595,40 @@ func prevIds(n *yaml.RNode) ([]resid.ResId, error) {
 //   - Json
 //   - Toml
 //   - Ini
+//   - Xml
+//   - Java properties
+//   - Dotenv
+//   - Hcl
+//   - Pem
+//
+// It also provides helpers for changing content in base64 encoded or gzip/zlib
+// compressed properties as well as a simple regexp based replacer for edge
+// cases.
 //
-// It also provides helpers for changing content in base64 encoded properties
-// as well as a simple regexp based replacer for edge cases.
+// Besides resources, the source of a replacement can be a literal value or an
+// environment variable listed in AllowedEnvVars.
+//
+// In addition to the kustomize options, targets accept an operation option
+// (replace, delete, append or merge). See [Operation].
 //
 // Configuration of replacements can be found in the [kustomize doc].
 //
 // [kustomize doc]: https://kubectl.docs.kubernetes.io/references/kustomize/kustomization/replacements/
 type ExtendedReplacementTransformerPlugin struct {
-	ReplacementList []types.ReplacementField `json:"replacements,omitempty" yaml:"replacements,omitempty"`
-	Replacements    []types.Replacement      `json:"omitempty" yaml:"omitempty"`
-	Source          string                   `json:"source,omitempty" yaml:"source,omitempty"`
+	ReplacementList []ReplacementField  `json:"replacements,omitempty" yaml:"replacements,omitempty"`
+	Replacements    []Replacement       `json:"omitempty" yaml:"omitempty"`
+	Source          string              `json:"source,omitempty" yaml:"source,omitempty"`
+	Sources         []string            `json:"sources,omitempty" yaml:"sources,omitempty"`
+	SourceSets      map[string][]string `json:"sourceSets,omitempty" yaml:"sourceSets,omitempty"`
+	AllowedEnvVars  []string            `json:"allowedEnvVars,omitempty" yaml:"allowedEnvVars,omitempty"`
 	h               *resmap.PluginHelpers
+	results         framework.Results
 }
 
 // Config configures the plugin
 func (p *ExtendedReplacementTransformerPlugin) Config(
 	h *resmap.PluginHelpers, c []byte) (err error) {
-	p.ReplacementList = []types.ReplacementField{}
+	p.ReplacementList = []ReplacementField{}
 	if err := yaml.Unmarshal(c, p); err != nil {
 		return err
 	}
@@ -395,13 +653,13 @@ func (p *ExtendedReplacementTransformerPlugin) Config(
 			items := reflect.ValueOf(replacement)
 			switch items.Kind() {
 			case reflect.Slice:
-				repl := []types.Replacement{}
+				repl := []Replacement{}
 				if err := yaml.Unmarshal(content, &repl); err != nil {
 					return err
 				}
 				p.Replacements = append(p.Replacements, repl...)
 			case reflect.Map:
-				repl := types.Replacement{}
+				repl := Replacement{}
 				if err := yaml.Unmarshal(content, &repl); err != nil {
 					return err
 				}
@@ -418,32 +676,73 @@ func (p *ExtendedReplacementTransformerPlugin) Config(
 	return nil
 }
 
-// Transform performs the configured replacements in the specified resource map
-func (p *ExtendedReplacementTransformerPlugin) Transform(m resmap.ResMap) (err error) {
+// loadSource returns the resources contained in the file or the kustomization
+// at path.
+func (p *ExtendedReplacementTransformerPlugin) loadSource(path string) ([]*yaml.RNode, error) {
+	source, err := p.h.ResmapFactory().FromFile(p.h.Loader(), path)
+	if err != nil {
+		if errors.Is(err, loader.ErrHTTP) {
+			return nil, errors.Wrapf(err, "while reading source %s", path)
+		}
 
-	var sourceNodes []*yaml.RNode
-	if p.Source != "" {
-		source, err := p.h.ResmapFactory().FromFile(p.h.Loader(), p.Source)
+		source, err = runKustomizations(filesys.MakeFsOnDisk(), path)
 		if err != nil {
-			if errors.Is(err, loader.ErrHTTP) {
-				return errors.Wrapf(err, "while reading source %s", p.Source)
-			}
+			return nil, errors.Wrapf(err, "while getting source for replacements %s", path)
+		}
+	}
+	return source.ToRNodeSlice(), nil
+}
 
-			source, err = runKustomizations(filesys.MakeFsOnDisk(), p.Source)
-			if err != nil {
-				return errors.Wrapf(err, "while getting source for replacements %s", p.Source)
-			}
+// loadSourceSet loads the resources of all paths and merges them in order.
+func (p *ExtendedReplacementTransformerPlugin) loadSourceSet(paths []string) ([]*yaml.RNode, error) {
+	layers := [][]*yaml.RNode{}
+	for _, path := range paths {
+		layer, err := p.loadSource(path)
+		if err != nil {
+			return nil, err
 		}
+		layers = append(layers, layer)
+	}
+	return mergeSourceNodes(layers...)
+}
 
-		sourceNodes = source.ToRNodeSlice()
+// Transform performs the configured replacements in the specified resource map
+func (p *ExtendedReplacementTransformerPlugin) Transform(m resmap.ResMap) (err error) {
+	sourceSets := map[string][]*yaml.RNode{}
+
+	paths := p.Sources
+	if p.Source != "" {
+		paths = append([]string{p.Source}, paths...)
+	}
+	if len(paths) > 0 {
+		if sourceSets[defaultSourceSet], err = p.loadSourceSet(paths); err != nil {
+			return err
+		}
+	}
+	for name, paths := range p.SourceSets {
+		if name == defaultSourceSet {
+			return fmt.Errorf("source sets must have a name")
+		}
+		if sourceSets[name], err = p.loadSourceSet(paths); err != nil {
+			return errors.Wrapf(err, "while loading source set %s", name)
+		}
 	}
 
+	p.results = framework.Results{}
 	return m.ApplyFilter(extendedFilter{
-		Replacements: p.Replacements,
-		sourceNodes:  sourceNodes,
+		Replacements:   p.Replacements,
+		sourceSets:     sourceSets,
+		allowedEnvVars: p.AllowedEnvVars,
+		results:        &p.results,
 	})
 }
 
+// Results returns the replacements skipped during the last transformation
+// because their source was not found.
+func (p *ExtendedReplacementTransformerPlugin) Results() framework.Results {
+	return p.results
+}
+
 // NewExtendedReplacementTransformerPlugin returns a newly created [ExtendedReplacementTransformerPlugin]
 func NewExtendedReplacementTransformerPlugin() resmap.TransformerPlugin {
 	return &ExtendedReplacementTransformerPlugin{}
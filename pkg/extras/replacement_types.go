@@ -0,0 +1,154 @@
+package extras
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Operation is the operation performed on the fields of a replacement target.
+type Operation string
+
+const (
+	// ReplaceOperation replaces the target field with the source value. This
+	// is the default.
+	ReplaceOperation Operation = "replace"
+	// DeleteOperation removes the target field. The source is optional.
+	DeleteOperation Operation = "delete"
+	// AppendOperation appends the source value to the target field. If the
+	// target is a sequence, the source value (or its elements if it is a
+	// sequence) is added at the end of it. If the target is a scalar, the
+	// source value is concatenated to it.
+	AppendOperation Operation = "append"
+	// MergeOperation merges the source mapping into the target mapping.
+	MergeOperation Operation = "merge"
+)
+
+// FieldOptions refine the interpretation of FieldPaths. It adds the operation
+// to perform to the kustomize options.
+type FieldOptions struct {
+	types.FieldOptions `json:",inline" yaml:",inline"`
+
+	// The operation to perform on the target field. Defaults to replace.
+	Operation Operation `json:"operation,omitempty" yaml:"operation,omitempty"`
+}
+
+// GetOperation returns the operation specified by the options, defaulting to
+// [ReplaceOperation].
+func (fo *FieldOptions) GetOperation() (Operation, error) {
+	if fo == nil || fo.Operation == "" {
+		return ReplaceOperation, nil
+	}
+	switch fo.Operation {
+	case ReplaceOperation, DeleteOperation, AppendOperation, MergeOperation:
+		return fo.Operation, nil
+	}
+	return "", fmt.Errorf("unknown operation %s", fo.Operation)
+}
+
+// kustomizeOptions returns the kustomize part of the options.
+func (fo *FieldOptions) kustomizeOptions() *types.FieldOptions {
+	if fo == nil {
+		return nil
+	}
+	return &fo.FieldOptions
+}
+
+// TargetSelector specifies fields in one or more objects.
+type TargetSelector struct {
+	// Include objects that match this.
+	Select *types.Selector `json:"select" yaml:"select"`
+
+	// From the allowed set, remove objects that match this.
+	Reject []*types.Selector `json:"reject,omitempty" yaml:"reject,omitempty"`
+
+	// Structured field paths expected in each allowed object.
+	FieldPaths []string `json:"fieldPaths,omitempty" yaml:"fieldPaths,omitempty"`
+
+	// Used to refine the interpretation of the field.
+	Options *FieldOptions `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// SourceSelector is the source of the replacement transformer. It adds an
+// ordered list of transforms applied to the value to the kustomize selector.
+type SourceSelector struct {
+	types.SourceSelector `json:",inline" yaml:",inline"`
+
+	// Transforms applied in order to the selected value.
+	Transforms []*Transform `json:"transforms,omitempty" yaml:"transforms,omitempty"`
+}
+
+// Replacement defines how to perform a substitution where it is from and
+// where it is to.
+type Replacement struct {
+	// The source of the value.
+	Source *SourceSelector `json:"source,omitempty" yaml:"source,omitempty"`
+
+	// Sources whose values are available in Template under their key.
+	Sources map[string]*SourceSelector `json:"sources,omitempty" yaml:"sources,omitempty"`
+
+	// Go text template building the value from Sources. Cannot be used with
+	// Source.
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+
+	// Literal value of the replacement. It can be a scalar or a structure.
+	// Cannot be used with Source or Template.
+	Value yaml.Node `json:"value,omitempty" yaml:"value,omitempty"`
+
+	// Name of the environment variable containing the value of the
+	// replacement. The variable must be allowed in the function configuration.
+	EnvVar string `json:"envVar,omitempty" yaml:"envVar,omitempty"`
+
+	// Source used when Source is not found.
+	Fallback *SourceSelector `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+
+	// Value used when the source is not found. It can be a scalar or a
+	// structure.
+	Default yaml.Node `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// If true, the replacement is skipped instead of failing when its source
+	// is not found.
+	Optional bool `json:"optional,omitempty" yaml:"optional,omitempty"`
+
+	// The name of the source set containing the sources. The in-pipeline
+	// resources are used when a source is not found in the source set.
+	SourceSet string `json:"sourceSet,omitempty" yaml:"sourceSet,omitempty"`
+
+	// The N fields to write the value to.
+	Targets []*TargetSelector `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+// sourceCount returns the number of sources specified by the replacement
+// among Source, Template, Value and EnvVar.
+func (r *Replacement) sourceCount() int {
+	count := 0
+	for _, specified := range []bool{r.Source != nil, r.Template != "", !r.Value.IsZero(), r.EnvVar != ""} {
+		if specified {
+			count++
+		}
+	}
+	return count
+}
+
+// needsSource returns true if at least one of the replacement targets needs
+// a source value.
+func (r *Replacement) needsSource() (bool, error) {
+	for _, target := range r.Targets {
+		operation, err := target.Options.GetOperation()
+		if err != nil {
+			return false, err
+		}
+		if operation != DeleteOperation {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReplacementField is either a replacement or the path of a file containing
+// replacements.
+type ReplacementField struct {
+	Replacement `json:",inline,omitempty" yaml:",inline,omitempty"`
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+}
@@ -0,0 +1,380 @@
+package extras
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/keyservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// sopsMetadataKey is the top level key of the sops metadata in encrypted
+// documents.
+const sopsMetadataKey = "sops"
+
+// sopsKeyServices returns the key services used to encrypt and decrypt sops
+// data keys.
+func sopsKeyServices() []keyservice.KeyServiceClient {
+	return []keyservice.KeyServiceClient{keyservice.NewLocalClient()}
+}
+
+// Sops key types, as named in the sops metadata.
+const (
+	AgeKeyType     = "age"
+	PgpKeyType     = "pgp"
+	KmsKeyType     = "kms"
+	GcpKmsKeyType  = "gcp_kms"
+	AzureKvKeyType = "azure_kv"
+	VaultKeyType   = "hc_vault"
+)
+
+// sopsKeyType returns the type of key.
+func sopsKeyType(key keys.MasterKey) string {
+	k := keyservice.KeyFromMasterKey(key)
+	switch {
+	case k.GetAgeKey() != nil:
+		return AgeKeyType
+	case k.GetPgpKey() != nil:
+		return PgpKeyType
+	case k.GetKmsKey() != nil:
+		return KmsKeyType
+	case k.GetGcpKmsKey() != nil:
+		return GcpKmsKeyType
+	case k.GetAzureKeyvaultKey() != nil:
+		return AzureKvKeyType
+	case k.GetVaultKey() != nil:
+		return VaultKeyType
+	}
+	return ""
+}
+
+// SopsKeyOptions configure the keys and key services used to decrypt sops
+// content.
+type SopsKeyOptions struct {
+	// Types of keys allowed to decrypt the data key (age, pgp, kms, gcp_kms,
+	// azure_kv or hc_vault). All types are allowed if empty.
+	KeyTypes []string `json:"keyTypes,omitempty" yaml:"keyTypes,omitempty"`
+	// File containing the age identities. It replaces SOPS_AGE_KEY and
+	// SOPS_AGE_KEY_FILE.
+	AgeKeyFile string `json:"ageKeyFile,omitempty" yaml:"ageKeyFile,omitempty"`
+	// Environment variable containing the age identities. It replaces
+	// SOPS_AGE_KEY and SOPS_AGE_KEY_FILE.
+	AgeKeyEnv string `json:"ageKeyEnv,omitempty" yaml:"ageKeyEnv,omitempty"`
+	// URIs of remote key services, like tcp://localhost:5000 or
+	// unix:///tmp/sops.sock.
+	KeyServices []string `json:"keyServices,omitempty" yaml:"keyServices,omitempty"`
+	// If true, the data key is only decrypted by the remote key services.
+	DisableLocalKeyService bool `json:"disableLocalKeyService,omitempty" yaml:"disableLocalKeyService,omitempty"`
+}
+
+// Validate checks the options.
+func (o *SopsKeyOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, keyType := range o.KeyTypes {
+		switch keyType {
+		case AgeKeyType, PgpKeyType, KmsKeyType, GcpKmsKeyType, AzureKvKeyType, VaultKeyType:
+		default:
+			return fmt.Errorf("unknown sops key type %s", keyType)
+		}
+	}
+	if o.AgeKeyFile != "" && o.AgeKeyEnv != "" {
+		return fmt.Errorf("only one of ageKeyFile and ageKeyEnv can be specified")
+	}
+	if o.DisableLocalKeyService && len(o.KeyServices) == 0 && o.AgeKeyFile == "" && o.AgeKeyEnv == "" {
+		return fmt.Errorf("no key service left when disabling the local one")
+	}
+	for _, uri := range o.KeyServices {
+		if _, _, err := keyServiceAddress(uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ageIdentities returns the age identities of the age key file or
+// environment variable, or nil if none is specified.
+func (o *SopsKeyOptions) ageIdentities() ([]age.Identity, error) {
+	var content []byte
+	switch {
+	case o.AgeKeyFile != "":
+		var err error
+		if content, err = os.ReadFile(o.AgeKeyFile); err != nil {
+			return nil, errors.WrapPrefixf(err, "while reading age key file")
+		}
+	case o.AgeKeyEnv != "":
+		value, ok := os.LookupEnv(o.AgeKeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", o.AgeKeyEnv)
+		}
+		content = []byte(value)
+	default:
+		return nil, nil
+	}
+	return age.ParseIdentities(bytes.NewReader(content))
+}
+
+// keyServiceAddress returns the network and address of the key service uri.
+func keyServiceAddress(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", errors.WrapPrefixf(err, "invalid key service %s", uri)
+	}
+	switch u.Scheme {
+	case "tcp":
+		return u.Scheme, u.Host, nil
+	case "unix":
+		return u.Scheme, u.Path, nil
+	}
+	return "", "", fmt.Errorf("invalid key service %s: scheme must be tcp or unix", uri)
+}
+
+// keyServices returns the key services configured by the options. With nil
+// options, only the local key service is returned. The returned function
+// closes the connections to the remote key services and must be called once
+// the key services are not used anymore.
+func (o *SopsKeyOptions) keyServices() ([]keyservice.KeyServiceClient, func(), error) {
+	if o == nil {
+		return sopsKeyServices(), func() {}, nil
+	}
+	services := []keyservice.KeyServiceClient{}
+	var local keyservice.KeyServiceClient
+	if !o.DisableLocalKeyService {
+		local = keyservice.NewLocalClient()
+	}
+	identities, err := o.ageIdentities()
+	if err != nil {
+		return nil, nil, err
+	}
+	if identities != nil {
+		services = append(services, &ageKeyService{identities: identities, next: local})
+	} else if local != nil {
+		services = append(services, local)
+	}
+
+	conns := []*grpc.ClientConn{}
+	closeConns := func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	for _, uri := range o.KeyServices {
+		network, address, err := keyServiceAddress(uri)
+		if err != nil {
+			closeConns()
+			return nil, nil, err
+		}
+		conn, err := grpc.Dial(address,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			}))
+		if err != nil {
+			closeConns()
+			return nil, nil, errors.WrapPrefixf(err, "while connecting to key service %s", uri)
+		}
+		conns = append(conns, conn)
+		services = append(services, keyservice.NewKeyServiceClient(conn))
+	}
+	return services, closeConns, nil
+}
+
+// filterKeyGroups removes from metadata the keys whose type is not allowed.
+func (o *SopsKeyOptions) filterKeyGroups(metadata *sops.Metadata) error {
+	if o == nil || len(o.KeyTypes) == 0 {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, keyType := range o.KeyTypes {
+		allowed[keyType] = true
+	}
+	count := 0
+	groups := []sops.KeyGroup{}
+	for _, group := range metadata.KeyGroups {
+		filtered := sops.KeyGroup{}
+		for _, key := range group {
+			if allowed[sopsKeyType(key)] {
+				filtered = append(filtered, key)
+			}
+		}
+		count += len(filtered)
+		groups = append(groups, filtered)
+	}
+	if count == 0 {
+		return fmt.Errorf("no key of type %s to decrypt the data key", strings.Join(o.KeyTypes, ", "))
+	}
+	metadata.KeyGroups = groups
+	return nil
+}
+
+// ageKeyService is a key service decrypting age data keys with specific
+// identities. The other requests are passed to next.
+type ageKeyService struct {
+	identities []age.Identity
+	next       keyservice.KeyServiceClient
+}
+
+// Encrypt passes the request to the next key service.
+func (s *ageKeyService) Encrypt(ctx context.Context, req *keyservice.EncryptRequest, opts ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	if s.next == nil {
+		return nil, fmt.Errorf("no key service to encrypt the data key")
+	}
+	return s.next.Encrypt(ctx, req, opts...)
+}
+
+// Decrypt decrypts age data keys with the identities.
+func (s *ageKeyService) Decrypt(ctx context.Context, req *keyservice.DecryptRequest, opts ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	if req.Key.GetAgeKey() == nil {
+		if s.next == nil {
+			return nil, fmt.Errorf("no key service to decrypt the data key")
+		}
+		return s.next.Decrypt(ctx, req, opts...)
+	}
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(req.Ciphertext)), s.identities...)
+	if err != nil {
+		return nil, errors.WrapPrefixf(err, "while decrypting age data key")
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+// isSopsEncrypted returns true if the document contains sops metadata.
+func isSopsEncrypted(node *yaml.RNode) bool {
+	return node.Field(sopsMetadataKey) != nil
+}
+
+// sopsRecipients returns the sorted identifiers of the master keys of the
+// metadata.
+func sopsRecipients(metadata *sops.Metadata) []string {
+	recipients := []string{}
+	for _, group := range metadata.KeyGroups {
+		for _, key := range group {
+			recipients = append(recipients, fmt.Sprintf("%T:%s", key, key.ToString()))
+		}
+	}
+	sort.Strings(recipients)
+	return recipients
+}
+
+// sameSopsPolicy returns true if a and b have the same recipients and select
+// the same values for encryption.
+func sameSopsPolicy(a, b *sops.Metadata) bool {
+	return a.UnencryptedSuffix == b.UnencryptedSuffix &&
+		a.EncryptedSuffix == b.EncryptedSuffix &&
+		a.UnencryptedRegex == b.UnencryptedRegex &&
+		a.EncryptedRegex == b.EncryptedRegex &&
+		reflect.DeepEqual(sopsRecipients(a), sopsRecipients(b))
+}
+
+// sopsCiphertext is an encrypted value along with its plaintext.
+type sopsCiphertext struct {
+	plaintext  interface{}
+	ciphertext string
+}
+
+// stableCipher is a sops cipher that remembers the values it decrypts and
+// returns their previous ciphertext when they are encrypted again unchanged.
+// This keeps the encrypted documents stable when only some values change.
+type stableCipher struct {
+	sops.Cipher
+	// previous values by additional data, i.e. by path in the tree.
+	previous map[string][]sopsCiphertext
+}
+
+// newStableCipher returns a [stableCipher] wrapping c.
+func newStableCipher(c sops.Cipher) *stableCipher {
+	return &stableCipher{Cipher: c, previous: map[string][]sopsCiphertext{}}
+}
+
+// Decrypt decrypts ciphertext and records it.
+func (c *stableCipher) Decrypt(ciphertext string, key []byte, additionalData string) (interface{}, error) {
+	plaintext, err := c.Cipher.Decrypt(ciphertext, key, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	c.previous[additionalData] = append(c.previous[additionalData], sopsCiphertext{plaintext: plaintext, ciphertext: ciphertext})
+	return plaintext, nil
+}
+
+// Encrypt returns the previous ciphertext of plaintext at the same path if
+// any, or a new one.
+func (c *stableCipher) Encrypt(plaintext interface{}, key []byte, additionalData string) (string, error) {
+	for _, previous := range c.previous[additionalData] {
+		if reflect.DeepEqual(previous.plaintext, plaintext) {
+			return previous.ciphertext, nil
+		}
+	}
+	return c.Cipher.Encrypt(plaintext, key, additionalData)
+}
+
+// encryptSopsTree encrypts the tree with dataKey and updates its MAC. If the
+// computed MAC is equal to previousMac, the values haven't changed and the
+// modification time and MAC of the tree are kept.
+func encryptSopsTree(tree *sops.Tree, dataKey []byte, cipher sops.Cipher, previousMac string) error {
+	mac, err := tree.Encrypt(dataKey, cipher)
+	if err != nil {
+		return err
+	}
+	if previousMac != "" && mac == previousMac {
+		return nil
+	}
+	tree.Metadata.LastModified = time.Now().UTC()
+	tree.Metadata.MessageAuthenticationCode, err = cipher.Encrypt(mac, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	return err
+}
+
+// isInternalAnnotation returns true if the annotation is added by kustomize
+// or kyaml while processing resources and removed when they are saved.
+func isInternalAnnotation(name string) bool {
+	return strings.HasPrefix(name, "internal.config.kubernetes.io/") ||
+		name == kioutil.LegacyPathAnnotation ||
+		name == kioutil.LegacyIndexAnnotation ||
+		name == kioutil.LegacyIdAnnotation
+}
+
+// removeInternalAnnotations removes the internal annotations from node and
+// returns them. They must not be part of the encrypted content as they are
+// not saved and would make the MAC verification fail.
+func removeInternalAnnotations(node *yaml.RNode) (map[string]string, error) {
+	internal := map[string]string{}
+	for name, value := range node.GetAnnotations() {
+		if isInternalAnnotation(name) {
+			internal[name] = value
+			if _, err := node.Pipe(yaml.ClearAnnotation(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return internal, yaml.ClearEmptyAnnotations(node)
+}
+
+// restoreAnnotations sets annotations on node.
+func restoreAnnotations(node *yaml.RNode, annotations map[string]string) error {
+	for name, value := range annotations {
+		if err := node.PipeE(yaml.SetAnnotation(name, value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package extras
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // sha1sum is provided for compatibility
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// templateFuncs contains the functions available in replacement templates.
+// They are named and behave like their Sprig counterparts, so that the last
+// argument can be piped.
+var templateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join": func(sep string, values interface{}) (string, error) {
+		switch v := values.(type) {
+		case []string:
+			return strings.Join(v, sep), nil
+		case []interface{}:
+			result := []string{}
+			for _, item := range v {
+				result = append(result, fmt.Sprint(item))
+			}
+			return strings.Join(result, sep), nil
+		}
+		return "", fmt.Errorf("cannot join %T", values)
+	},
+	"quote": strconv.Quote,
+	"default": func(d interface{}, given interface{}) interface{} {
+		if given == nil || given == "" {
+			return d
+		}
+		return given
+	},
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		return string(decoded), err
+	},
+	"sha256sum": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"sha1sum": func(s string) string {
+		sum := sha1.Sum([]byte(s)) //nolint:gosec // sha1sum is provided for compatibility
+		return hex.EncodeToString(sum[:])
+	},
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"toYaml": func(v interface{}) (string, error) {
+		b, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(b), "\n"), err
+	},
+}
+
+// templateValue returns the value of node to use in templates. Scalars are
+// returned as strings and other nodes as maps and slices.
+func templateValue(node *yaml.RNode) (interface{}, error) {
+	if node.YNode().Kind == yaml.ScalarNode {
+		return yaml.GetValue(node), nil
+	}
+	var result interface{}
+	if err := node.YNode().Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getTemplateReplacement returns the value of the replacement r obtained by
+// executing its template with the values of its sources. The value of each
+// source is available under its key.
+func getTemplateReplacement(nodes [][]*yaml.RNode, r *Replacement) (*yaml.RNode, error) {
+	tmpl, err := template.New("replacement").Option("missingkey=error").Funcs(templateFuncs).Parse(r.Template)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while parsing replacement template")
+	}
+
+	names := []string{}
+	for name := range r.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := map[string]interface{}{}
+	for _, name := range names {
+		source := r.Sources[name]
+		if source == nil {
+			return nil, fmt.Errorf("template source %s is empty", name)
+		}
+		node, _, err := getSourceValue(nodes, source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while getting template source %s", name)
+		}
+		value, err := templateValue(node)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while decoding template source %s", name)
+		}
+		values[name] = value
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, values); err != nil {
+		return nil, errors.Wrapf(err, "while executing replacement template")
+	}
+	return yaml.NewStringRNode(b.String()), nil
+}
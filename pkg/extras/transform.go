@@ -0,0 +1,297 @@
+package extras
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// TransformType is the type of a [Transform].
+type TransformType string
+
+const (
+	// Base64DecodeTransform decodes the base64 encoded value.
+	Base64DecodeTransform TransformType = "base64decode"
+	// Base64EncodeTransform encodes the value in base64.
+	Base64EncodeTransform TransformType = "base64encode"
+	// Sha256Transform returns the hex encoded SHA-256 sum of the value.
+	Sha256Transform TransformType = "sha256"
+	// Sha512Transform returns the hex encoded SHA-512 sum of the value.
+	Sha512Transform TransformType = "sha512"
+	// BcryptTransform returns the bcrypt hash of the value.
+	BcryptTransform TransformType = "bcrypt"
+	// HtpasswdTransform returns the htpasswd entry of the value.
+	HtpasswdTransform TransformType = "htpasswd"
+	// URLEncodeTransform escapes the value for use in URL queries.
+	URLEncodeTransform TransformType = "urlencode"
+	// LowerTransform converts the value to lower case.
+	LowerTransform TransformType = "lower"
+	// UpperTransform converts the value to upper case.
+	UpperTransform TransformType = "upper"
+	// TrimTransform removes leading and trailing white spaces.
+	TrimTransform TransformType = "trim"
+	// RegexTransform returns a group captured by a regular expression.
+	RegexTransform TransformType = "regex"
+	// JSONQuoteTransform quotes the value as a JSON string.
+	JSONQuoteTransform TransformType = "jsonquote"
+	// YAMLQuoteTransform quotes the value as a single quoted YAML string.
+	YAMLQuoteTransform TransformType = "yamlquote"
+	// SplitTransform returns an element of the value split by a delimiter.
+	SplitTransform TransformType = "split"
+)
+
+// Apr1Algorithm and BcryptAlgorithm are the htpasswd hash algorithms.
+const (
+	Apr1Algorithm   = "apr1"
+	BcryptAlgorithm = "bcrypt"
+)
+
+// Transform is a step of the transformation of a replacement source value.
+type Transform struct {
+	// The type of transformation.
+	Type TransformType `json:"type" yaml:"type"`
+
+	// The htpasswd hash algorithm, apr1 (default) or bcrypt.
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+
+	// The bcrypt cost. Defaults to 10.
+	Cost int `json:"cost,omitempty" yaml:"cost,omitempty"`
+
+	// The user name of the htpasswd entry. If empty, only the hash is
+	// returned.
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+
+	// The regular expression of regex transforms.
+	Regex string `json:"regex,omitempty" yaml:"regex,omitempty"`
+
+	// The group captured by regex transforms. If zero, the first group is
+	// returned if the expression contains groups, otherwise the whole match.
+	Group int `json:"group,omitempty" yaml:"group,omitempty"`
+
+	// The delimiter of split transforms.
+	Delimiter string `json:"delimiter,omitempty" yaml:"delimiter,omitempty"`
+
+	// The index of the element returned by split transforms.
+	Index int `json:"index,omitempty" yaml:"index,omitempty"`
+
+	// Seed from which the salt of bcrypt and htpasswd transforms is derived,
+	// together with the target resource id and field path. When set, hashing
+	// the same value for the same target always gives the same result. Only
+	// valid on a last bcrypt or htpasswd transform.
+	Seed string `json:"seed,omitempty" yaml:"seed,omitempty"`
+
+	// If true, targets already containing a hash of the value are left
+	// untouched. Only valid on a last bcrypt or htpasswd transform.
+	KeepExisting bool `json:"keepExisting,omitempty" yaml:"keepExisting,omitempty"`
+}
+
+// transformer is a function applying a [Transform] to a value.
+type transformer func(t *Transform, value string) (string, error)
+
+// transformers contains the transformer of each [TransformType].
+var transformers = map[TransformType]transformer{
+	Base64DecodeTransform: func(_ *Transform, value string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		return string(decoded), err
+	},
+	Base64EncodeTransform: func(_ *Transform, value string) (string, error) {
+		return EncodeBase64(value)
+	},
+	Sha256Transform: func(_ *Transform, value string) (string, error) {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:]), nil
+	},
+	Sha512Transform: func(_ *Transform, value string) (string, error) {
+		sum := sha512.Sum512([]byte(value))
+		return hex.EncodeToString(sum[:]), nil
+	},
+	BcryptTransform: func(t *Transform, value string) (string, error) {
+		return bcryptHash(value, t.Cost, t.Seed, "")
+	},
+	HtpasswdTransform: func(t *Transform, value string) (string, error) {
+		return htpasswdTransform(t, value, "")
+	},
+	URLEncodeTransform: func(_ *Transform, value string) (string, error) {
+		return url.QueryEscape(value), nil
+	},
+	LowerTransform: func(_ *Transform, value string) (string, error) {
+		return strings.ToLower(value), nil
+	},
+	UpperTransform: func(_ *Transform, value string) (string, error) {
+		return strings.ToUpper(value), nil
+	},
+	TrimTransform: func(_ *Transform, value string) (string, error) {
+		return strings.TrimSpace(value), nil
+	},
+	RegexTransform: regexTransform,
+	JSONQuoteTransform: func(_ *Transform, value string) (string, error) {
+		quoted, err := json.Marshal(value)
+		return string(quoted), err
+	},
+	YAMLQuoteTransform: func(_ *Transform, value string) (string, error) {
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'", nil
+	},
+	SplitTransform: func(t *Transform, value string) (string, error) {
+		if t.Delimiter == "" {
+			return "", fmt.Errorf("split transform needs a delimiter")
+		}
+		elements := strings.Split(value, t.Delimiter)
+		if t.Index >= len(elements) || t.Index < 0 {
+			return "", fmt.Errorf("index %d is out of bounds for value %s", t.Index, value)
+		}
+		return elements[t.Index], nil
+	},
+}
+
+// htpasswdTransform returns the htpasswd entry of the password value. If the
+// transform has a seed, the salt is derived from it and target.
+func htpasswdTransform(t *Transform, value, target string) (string, error) {
+	var hash string
+	switch t.Algorithm {
+	case "", Apr1Algorithm:
+		salt, err := apr1Salt(t.Seed, target)
+		if err != nil {
+			return "", err
+		}
+		hash = apr1Crypt([]byte(value), salt)
+	case BcryptAlgorithm:
+		var err error
+		if hash, err = bcryptHash(value, t.Cost, t.Seed, target); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown htpasswd algorithm %s", t.Algorithm)
+	}
+	if t.User == "" {
+		return hash, nil
+	}
+	return t.User + ":" + hash, nil
+}
+
+// regexTransform returns the group t.Group captured by t.Regex in value.
+func regexTransform(t *Transform, value string) (string, error) {
+	re, err := regexp.Compile(t.Regex)
+	if err != nil {
+		return "", errors.Wrapf(err, "while compiling regex %s", t.Regex)
+	}
+	group := t.Group
+	if group == 0 && re.NumSubexp() > 0 {
+		group = 1
+	}
+	if group < 0 || group > re.NumSubexp() {
+		return "", fmt.Errorf("regex %s has no group %d", t.Regex, group)
+	}
+	matches := re.FindStringSubmatch(value)
+	if matches == nil {
+		return "", fmt.Errorf("regex %s does not match %s", t.Regex, value)
+	}
+	return matches[group], nil
+}
+
+// targetTransform is the last transform of a source when its result depends on
+// the target: seeded hashes derive their salt from the target and hashes kept
+// when existing are checked against the current target value.
+type targetTransform struct {
+	transform *Transform
+	input     string // the value before the transform
+}
+
+// newTargetTransform returns the [targetTransform] applying t to input, or nil
+// if t neither keeps existing values nor has a seed.
+func newTargetTransform(t *Transform, input string) (*targetTransform, error) {
+	if !t.KeepExisting && t.Seed == "" {
+		return nil, nil
+	}
+	if t.Type != BcryptTransform && t.Type != HtpasswdTransform {
+		if t.KeepExisting {
+			return nil, fmt.Errorf("keepExisting cannot be used with %s transforms", t.Type)
+		}
+		return nil, fmt.Errorf("seed cannot be used with %s transforms", t.Type)
+	}
+	return &targetTransform{transform: t, input: input}, nil
+}
+
+// verify returns true if the existing value of a target is equivalent to the
+// replacement value, i.e. it is a hash of the input.
+func (tt *targetTransform) verify(existing string) bool {
+	if tt == nil || !tt.transform.KeepExisting {
+		return false
+	}
+	t := tt.transform
+	if t.Type == HtpasswdTransform {
+		if t.User != "" {
+			user, hash, found := strings.Cut(existing, ":")
+			if !found || user != t.User {
+				return false
+			}
+			existing = hash
+		}
+		if t.Algorithm != BcryptAlgorithm {
+			return apr1Verify(existing, tt.input)
+		}
+	}
+	return bcryptVerify(existing, tt.input, t.Cost)
+}
+
+// apply returns the replacement value for target, a resource id and field
+// path. value is returned as is unless the transform has a seed.
+func (tt *targetTransform) apply(value *yaml.RNode, target string) (*yaml.RNode, error) {
+	if tt == nil || tt.transform.Seed == "" {
+		return value, nil
+	}
+	t := tt.transform
+	var result string
+	var err error
+	if t.Type == HtpasswdTransform {
+		result, err = htpasswdTransform(t, tt.input, target)
+	} else {
+		result, err = bcryptHash(tt.input, t.Cost, t.Seed, target)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "while applying %s transform", t.Type)
+	}
+	return yaml.NewStringRNode(result), nil
+}
+
+// applyTransforms applies transforms in order to the scalar value. If the last
+// transform keeps existing values or has a seed, it also returns the
+// [targetTransform] giving the value of each target.
+func applyTransforms(transforms []*Transform, value *yaml.RNode) (*yaml.RNode, *targetTransform, error) {
+	if len(transforms) == 0 {
+		return value, nil, nil
+	}
+	if value.YNode().Kind != yaml.ScalarNode {
+		return nil, nil, fmt.Errorf("transforms can only be applied to scalar nodes")
+	}
+	result := yaml.GetValue(value)
+	var last *targetTransform
+	for i, t := range transforms {
+		if t == nil {
+			return nil, nil, fmt.Errorf("transform %d is empty", i)
+		}
+		f, ok := transformers[t.Type]
+		if !ok {
+			return nil, nil, fmt.Errorf("transform %d has unknown type %s", i, t.Type)
+		}
+		if (t.KeepExisting || t.Seed != "") && i != len(transforms)-1 {
+			return nil, nil, fmt.Errorf("keepExisting and seed can only be set on the last transform")
+		}
+		var err error
+		if last, err = newTargetTransform(t, result); err != nil {
+			return nil, nil, err
+		}
+		if result, err = f(t, result); err != nil {
+			return nil, nil, errors.Wrapf(err, "while applying transform %d (%s)", i, t.Type)
+		}
+	}
+	return yaml.NewStringRNode(result), last, nil
+}
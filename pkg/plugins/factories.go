@@ -41,6 +41,8 @@ const (
 	RemoveTransformer
 	KustomizationGenerator
 	SopsGenerator
+	ChecksumTransformer
+	SopsEncryptTransformer
 )
 
 var stringToBuiltinPluginTypeMap map[string]BuiltinPluginType
@@ -50,7 +52,7 @@ func init() { //nolint:gochecknoinits
 }
 
 func makeStringToBuiltinPluginTypeMap() (result map[string]BuiltinPluginType) {
-	result = make(map[string]BuiltinPluginType, 23)
+	result = make(map[string]BuiltinPluginType, 25)
 	for k := range TransformerFactories {
 		result[k.String()] = k
 	}
@@ -113,6 +115,8 @@ var TransformerFactories = map[BuiltinPluginType]func() resmap.TransformerPlugin
 	ReplicaCountTransformer:        builtins.NewReplicaCountTransformerPlugin,
 	ValueAddTransformer:            builtins.NewValueAddTransformerPlugin,
 	RemoveTransformer:              extras.NewRemoveTransformerPlugin,
+	ChecksumTransformer:            extras.NewChecksumTransformerPlugin,
+	SopsEncryptTransformer:         extras.NewSopsEncryptTransformerPlugin,
 	// Do not wired SortOrderTransformer as a builtin plugin.
 	// We only want it to be available in the top-level kustomization.
 	// See: https://github.com/kubernetes-sigs/kustomize/issues/3913